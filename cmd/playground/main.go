@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"github.com/samber/lo"
 	log "github.com/sirupsen/logrus"
 	"github.com/vegidio/umd-lib"
 	"github.com/vegidio/umd-lib/fetch"
@@ -50,7 +49,9 @@ func queryDownload() {
 		log.Error(err)
 	}
 
-	co, _ := fetch.GetBrowserCookies("https://coomer.st/onlyfans/user/belledelphine", "header.user-header")
+	co, _ := fetch.GetBrowserCookies("https://coomer.st/onlyfans/user/belledelphine", fetch.BrowserCookieOptions{
+		Selector: "header.user-header",
+	})
 	header := fetch.CookiesToHeader(co)
 	headers := map[string]string{
 		"Cookie": header,
@@ -58,10 +59,8 @@ func queryDownload() {
 
 	f := fetch.New(headers, 10)
 
-	requests := lo.Map(resp.Media, func(media umd.Media, index int) *fetch.Request {
-		req, _ := f.NewRequest(media.Url, fmt.Sprintf("media%d.blah", index))
-		return req
-	})
+	template, _ := fetch.ParsePathTemplate("{extractor}/{name}/{created:2006-01-02}_{filename}.{ext}")
+	requests, _ := f.NewMediaRequests(resp.Media, "downloads", template)
 
 	result, _ := f.DownloadFiles(requests, 5)
 
@@ -103,7 +102,9 @@ func downloadFiles() {
 }
 
 func browserCookies() {
-	co, err := fetch.GetBrowserCookies("https://coomer.st/onlyfans/user/belledelphine", "header.user-header")
+	co, err := fetch.GetBrowserCookies("https://coomer.st/onlyfans/user/belledelphine", fetch.BrowserCookieOptions{
+		Selector: "header.user-header",
+	})
 
 	if err != nil {
 		log.Error(err)
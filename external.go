@@ -1,14 +1,17 @@
 package umd
 
 import (
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
 	"sync"
 )
 
-type External struct{}
+type External struct {
+	options []fetch.Option
+}
 
-func (External) ExpandMedia(media []model.Media, ignoreHost string, metadata *model.Metadata, parallel int) []model.Media {
+func (e External) ExpandMedia(media []model.Media, ignoreHost string, metadata *model.Metadata, parallel int) []model.Media {
 	result := make([]model.Media, 0)
 
 	var mu sync.Mutex
@@ -27,7 +30,7 @@ func (External) ExpandMedia(media []model.Media, ignoreHost string, metadata *mo
 			sem <- struct{}{}
 
 			if current.Type == model.Unknown && !utils.HasHost(current.Url, ignoreHost) {
-				extractor, err := New(*metadata).FindExtractor(current.Url)
+				extractor, err := New(*metadata, e.options...).FindExtractor(current.Url)
 				if err != nil {
 					appendResult(&mu, &result, current)
 					return
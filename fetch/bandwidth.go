@@ -0,0 +1,70 @@
+package fetch
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// bandwidthChunk is the maximum number of bytes read at once from a throttled download. Small chunks keep the
+// transfer rate, and the progress reported, smooth.
+const bandwidthChunk = 32 * 1024
+
+// newBandwidthLimiter creates a token bucket where each token is a byte. Zero or negative values mean no limit.
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(bandwidthRate(bytesPerSecond), bandwidthChunk)
+}
+
+// SetBandwidthLimit changes, at runtime, the maximum bandwidth shared by all downloads of this Fetch instance.
+//
+// # Parameters:
+//   - bytesPerSecond: the maximum number of bytes downloaded per second; zero means no limit.
+func (f *Fetch) SetBandwidthLimit(bytesPerSecond int64) {
+	f.bandwidth.SetLimit(bandwidthRate(bytesPerSecond))
+}
+
+// SetBandwidthLimit changes, at runtime, the maximum bandwidth used by this download. The download is still limited
+// by the bandwidth set in the Fetch instance.
+//
+// # Parameters:
+//   - bytesPerSecond: the maximum number of bytes downloaded per second; zero means no limit.
+func (r *Response) SetBandwidthLimit(bytesPerSecond int64) {
+	r.bandwidth.SetLimit(bandwidthRate(bytesPerSecond))
+}
+
+// region - Private functions
+
+func bandwidthRate(bytesPerSecond int64) rate.Limit {
+	if bytesPerSecond <= 0 {
+		return rate.Inf
+	}
+
+	return rate.Limit(bytesPerSecond)
+}
+
+// throttledReader is a reader that waits for tokens in all its limiters after each read.
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiters []*rate.Limiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+
+	n, err := tr.reader.Read(p)
+	if n > 0 {
+		for _, limiter := range tr.limiters {
+			if wErr := limiter.WaitN(tr.ctx, n); wErr != nil {
+				return n, wErr
+			}
+		}
+	}
+
+	return n, err
+}
+
+// endregion
@@ -0,0 +1,400 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+	_ "modernc.org/sqlite"
+)
+
+// Browser is a browser whose local profile can be used to read cookies.
+type Browser int
+
+const (
+	Firefox Browser = iota
+	Chrome
+	Chromium
+	Brave
+	Edge
+)
+
+func (b Browser) String() string {
+	switch b {
+	case Firefox:
+		return "Firefox"
+	case Chrome:
+		return "Chrome"
+	case Chromium:
+		return "Chromium"
+	case Brave:
+		return "Brave"
+	case Edge:
+		return "Edge"
+	}
+
+	return "Unknown"
+}
+
+// chromiumPassword is the password used by Chromium to encrypt cookies on Linux when no keyring is available.
+const chromiumPassword = "peanuts"
+
+// chromiumEpoch is the difference, in seconds, between 1601-01-01, used by Chromium timestamps, and the Unix epoch.
+const chromiumEpoch = 11644473600
+
+// GetLocalCookies reads the cookies of a domain, and its subdomains, straight from the most recently used profile of a
+// browser installed locally, so sessions logged in the browser can be reused without exporting the cookies.
+//
+// The browser doesn't need to be closed. Cookies encrypted by Chromium-based browsers are decrypted with the password
+// saved in the keyring of the user or, if it's not available, with the default password used by Chromium.
+//
+// # Parameters:
+//   - browser: the browser to read the cookies from.
+//   - domain: the domain of the cookies, like "coomer.st"; an empty string returns all cookies.
+//
+// # Returns:
+//   - A slice of Cookie objects.
+//   - An error if the profile is not found or the cookies can't be read.
+func GetLocalCookies(browser Browser, domain string) ([]Cookie, error) {
+	profile, err := findProfile(browser)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetProfileCookies(browser, profile, domain)
+}
+
+// GetProfileCookies is like GetLocalCookies, but reads the cookies from a specific profile directory, like
+// "~/.mozilla/firefox/abcd1234.default-release" or "~/.config/google-chrome/Profile 1".
+//
+// # Parameters:
+//   - browser: the browser that created the profile.
+//   - profileDir: the path of the profile directory.
+//   - domain: the domain of the cookies, like "coomer.st"; an empty string returns all cookies.
+//
+// # Returns:
+//   - A slice of Cookie objects.
+//   - An error if the cookies can't be read.
+func GetProfileCookies(browser Browser, profileDir string, domain string) ([]Cookie, error) {
+	dbPath := cookieDatabase(browser, profileDir)
+	if dbPath == "" {
+		return nil, fmt.Errorf("no cookie database found in %s profile '%s'", browser, profileDir)
+	}
+
+	if browser == Firefox {
+		return readFirefoxCookies(dbPath, domain)
+	}
+
+	return readChromiumCookies(dbPath, domain, chromiumKeys(keyringPassword(browser)))
+}
+
+// region - Private functions
+
+// cookieDatabase returns the path of the cookie database in the profile directory, or an empty string if there's none.
+func cookieDatabase(browser Browser, profileDir string) string {
+	candidates := []string{filepath.Join(profileDir, "cookies.sqlite")}
+	if browser != Firefox {
+		// Newer versions of Chromium moved the database to the Network directory
+		candidates = []string{filepath.Join(profileDir, "Network", "Cookies"), filepath.Join(profileDir, "Cookies")}
+	}
+
+	for _, candidate := range candidates {
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// openCookieDatabase opens a copy of the database, since browsers keep it locked while they are running.
+func openCookieDatabase(dbPath string) (*sql.DB, func(), error) {
+	tempDir, err := os.MkdirTemp("", "umd-cookies-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	cleanup := func() { os.RemoveAll(tempDir) }
+	copyPath := filepath.Join(tempDir, filepath.Base(dbPath))
+
+	// The write-ahead log has the changes that were not merged into the database yet
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err = copyFile(dbPath+suffix, copyPath+suffix); err != nil && !(suffix != "" && os.IsNotExist(err)) {
+			cleanup()
+			return nil, nil, fmt.Errorf("could not copy cookie database: %w", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", copyPath)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("could not open cookie database: %w", err)
+	}
+
+	return db, func() { db.Close(); cleanup() }, nil
+}
+
+func readFirefoxCookies(dbPath string, domain string) ([]Cookie, error) {
+	db, closeDb, err := openCookieDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeDb()
+
+	rows, err := db.Query("SELECT name, value, host, path, expiry, isSecure, isHttpOnly FROM moz_cookies")
+	if err != nil {
+		return nil, fmt.Errorf("could not read Firefox cookies: %w", err)
+	}
+
+	defer rows.Close()
+
+	cookies := make([]Cookie, 0)
+	for rows.Next() {
+		var name, value, host, path string
+		var expiry int64
+		var secure, httpOnly bool
+
+		if err = rows.Scan(&name, &value, &host, &path, &expiry, &secure, &httpOnly); err != nil {
+			return nil, fmt.Errorf("could not read Firefox cookies: %w", err)
+		}
+
+		if !matchesCookieDomain(host, domain) {
+			continue
+		}
+
+		// Recent versions of Firefox save the expiration in milliseconds
+		var expires time.Time
+		if expiry > 1e11 {
+			expires = time.UnixMilli(expiry)
+		} else if expiry > 0 {
+			expires = time.Unix(expiry, 0)
+		}
+
+		cookies = append(cookies, Cookie{
+			Name:     name,
+			Value:    value,
+			Domain:   strings.TrimPrefix(host, "."),
+			HostOnly: !strings.HasPrefix(host, "."),
+			Path:     path,
+			Expires:  expires,
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		})
+	}
+
+	return cookies, rows.Err()
+}
+
+func readChromiumCookies(dbPath string, domain string, keys chromiumKeySet) ([]Cookie, error) {
+	db, closeDb, err := openCookieDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeDb()
+
+	// Since version 24 of the database, the decrypted values start with the SHA-256 of the host
+	var version int
+	_ = db.QueryRow("SELECT value FROM meta WHERE key = 'version'").Scan(&version)
+
+	rows, err := db.Query("SELECT host_key, name, value, encrypted_value, path, expires_utc, is_secure, is_httponly " +
+		"FROM cookies")
+	if err != nil {
+		return nil, fmt.Errorf("could not read Chromium cookies: %w", err)
+	}
+
+	defer rows.Close()
+
+	cookies := make([]Cookie, 0)
+	for rows.Next() {
+		var host, name, value, path string
+		var encrypted []byte
+		var expiresUtc int64
+		var secure, httpOnly bool
+
+		if err = rows.Scan(&host, &name, &value, &encrypted, &path, &expiresUtc, &secure, &httpOnly); err != nil {
+			return nil, fmt.Errorf("could not read Chromium cookies: %w", err)
+		}
+
+		if !matchesCookieDomain(host, domain) {
+			continue
+		}
+
+		if value == "" && len(encrypted) > 0 {
+			var hostHash []byte
+			if version >= 24 {
+				sum := sha256.Sum256([]byte(host))
+				hostHash = sum[:]
+			}
+
+			decrypted, decryptErr := decryptChromiumValue(encrypted, keys, hostHash)
+			if decryptErr != nil {
+				return nil, fmt.Errorf("could not decrypt cookie '%s' of %s: %w", name, host, decryptErr)
+			}
+
+			value = string(decrypted)
+		}
+
+		var expires time.Time
+		if expiresUtc > 0 {
+			expires = time.UnixMicro(expiresUtc - chromiumEpoch*1_000_000)
+		}
+
+		cookies = append(cookies, Cookie{
+			Name:     name,
+			Value:    value,
+			Domain:   strings.TrimPrefix(host, "."),
+			HostOnly: !strings.HasPrefix(host, "."),
+			Path:     path,
+			Expires:  expires,
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		})
+	}
+
+	return cookies, rows.Err()
+}
+
+// chromiumKeySet has the keys used to decrypt cookies; the prefix of the encrypted value says which one was used.
+type chromiumKeySet struct {
+	// v10 is the key of the values prefixed with "v10", derived from the default password.
+	v10 []byte
+
+	// v11 are the keys of the values prefixed with "v11": the one from the keyring password, if any, and the one from an
+	// empty password, used by Chromium when the keyring returns no password.
+	v11 [][]byte
+}
+
+// chromiumKeys derives the keys used to decrypt cookies from the keyring password, which can be empty.
+func chromiumKeys(password string) chromiumKeySet {
+	keys := chromiumKeySet{v10: chromiumKey(chromiumPassword)}
+	if password != "" {
+		keys.v11 = append(keys.v11, chromiumKey(password))
+	}
+
+	keys.v11 = append(keys.v11, chromiumKey(""))
+	return keys
+}
+
+func chromiumKey(password string) []byte {
+	return pbkdf2.Key([]byte(password), []byte("saltysalt"), 1, 16, sha1.New)
+}
+
+// decryptChromiumValue decrypts values prefixed with "v10" or "v11", encrypted with AES-128-CBC, with the key of the
+// prefix. Since version 24 of the database, the decrypted values start with the SHA-256 of the host, which is checked
+// and removed; a valid padding alone happens by chance with a wrong key, so it's only enough in older databases.
+//
+// # Parameters:
+//   - encrypted: the encrypted value, with its prefix.
+//   - keys: the keys of the profile.
+//   - hostHash: the SHA-256 of the host of the cookie, or nil if the database is older than version 24.
+func decryptChromiumValue(encrypted []byte, keys chromiumKeySet, hostHash []byte) ([]byte, error) {
+	if len(encrypted) < 3 {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	var candidates [][]byte
+	prefix := string(encrypted[:3])
+	switch prefix {
+	case "v10":
+		candidates = [][]byte{keys.v10}
+	case "v11":
+		candidates = keys.v11
+	default:
+		return nil, fmt.Errorf("unsupported encryption '%s'", prefix)
+	}
+
+	data := encrypted[3:]
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	iv := bytes.Repeat([]byte{' '}, aes.BlockSize)
+
+	for _, key := range candidates {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			continue
+		}
+
+		decrypted := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+		unpadded, ok := unpadPkcs7(decrypted)
+		if !ok {
+			continue
+		}
+
+		if hostHash == nil {
+			return unpadded, nil
+		}
+
+		if value, found := bytes.CutPrefix(unpadded, hostHash); found {
+			return value, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no valid key to decrypt the %s value", prefix)
+}
+
+func unpadPkcs7(data []byte) ([]byte, bool) {
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, false
+	}
+
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, false
+		}
+	}
+
+	return data[:len(data)-padding], true
+}
+
+// matchesCookieDomain checks if a cookie saved for the host must be returned for the domain. Cookies of parent domains
+// are also returned, since they are sent to the domain too.
+func matchesCookieDomain(host string, domain string) bool {
+	if domain == "" {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimPrefix(host, "."))
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+
+	return matchesHost(host, domain) || matchesHost(domain, host)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// endregion
@@ -0,0 +1,99 @@
+package fetch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// chromiumConfigDirs are the directories, inside $XDG_CONFIG_HOME, where Chromium-based browsers keep their profiles.
+var chromiumConfigDirs = map[Browser]string{
+	Chrome:   "google-chrome",
+	Chromium: "chromium",
+	Brave:    "BraveSoftware/Brave-Browser",
+	Edge:     "microsoft-edge",
+}
+
+// keyringApplications are the names used by Chromium-based browsers to save their password in the keyring.
+var keyringApplications = map[Browser]string{
+	Chrome:   "chrome",
+	Chromium: "chromium",
+	Brave:    "brave",
+	Edge:     "chromium",
+}
+
+// region - Private functions
+
+// findProfile returns the directory of the profile whose cookies were changed most recently.
+func findProfile(browser Browser) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find the home directory: %w", err)
+	}
+
+	patterns := make([]string, 0)
+
+	if browser == Firefox {
+		for _, dir := range []string{".mozilla/firefox", "snap/firefox/common/.mozilla/firefox",
+			".var/app/org.mozilla.firefox/.mozilla/firefox"} {
+			patterns = append(patterns, filepath.Join(home, dir, "*"))
+		}
+	} else {
+		dir, exists := chromiumConfigDirs[browser]
+		if !exists {
+			return "", fmt.Errorf("unsupported browser %s", browser)
+		}
+
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+
+		patterns = append(patterns, filepath.Join(configHome, dir, "Default"),
+			filepath.Join(configHome, dir, "Profile *"))
+	}
+
+	profile := ""
+	var latest int64
+
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			dbPath := cookieDatabase(browser, match)
+			if dbPath == "" {
+				continue
+			}
+
+			if info, statErr := os.Stat(dbPath); statErr == nil && info.ModTime().UnixNano() > latest {
+				latest = info.ModTime().UnixNano()
+				profile = match
+			}
+		}
+	}
+
+	if profile == "" {
+		return "", fmt.Errorf("no %s profile found", browser)
+	}
+
+	return profile, nil
+}
+
+// keyringPassword returns the password saved by the browser in the keyring through the Secret Service, or an empty
+// string if it's not available.
+func keyringPassword(browser Browser) string {
+	application, exists := keyringApplications[browser]
+	if !exists {
+		return ""
+	}
+
+	output, err := exec.Command("secret-tool", "lookup", "application", application).Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// endregion
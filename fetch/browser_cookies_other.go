@@ -0,0 +1,18 @@
+//go:build !linux
+
+package fetch
+
+import "fmt"
+
+// region - Private functions
+
+func findProfile(browser Browser) (string, error) {
+	return "", fmt.Errorf("reading %s profiles is only supported on Linux; use GetProfileCookies instead", browser)
+}
+
+// keyringPassword is only available on Linux; other systems fall back to the default password.
+func keyringPassword(_ Browser) string {
+	return ""
+}
+
+// endregion
@@ -0,0 +1,145 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptChromiumValue encrypts the value like Chromium does on Linux.
+func encryptChromiumValue(prefix string, key []byte, value []byte) []byte {
+	padding := aes.BlockSize - len(value)%aes.BlockSize
+	data := append(append([]byte{}, value...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, _ := aes.NewCipher(key)
+	cipher.NewCBCEncrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(data, data)
+
+	return append([]byte(prefix), data...)
+}
+
+func createDatabase(t *testing.T, dbPath string, statements ...string) {
+	os.MkdirAll(filepath.Dir(dbPath), 0755)
+
+	db, err := sql.Open("sqlite", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		assert.NoError(t, err)
+	}
+}
+
+func TestGetProfileCookies_Firefox(t *testing.T) {
+	profile := t.TempDir()
+	createDatabase(t, filepath.Join(profile, "cookies.sqlite"),
+		"CREATE TABLE moz_cookies (name TEXT, value TEXT, host TEXT, path TEXT, expiry INTEGER, isSecure INTEGER, "+
+			"isHttpOnly INTEGER)",
+		"INSERT INTO moz_cookies VALUES ('session', 'abc', '.coomer.st', '/', 4102444800, 1, 1)",
+		"INSERT INTO moz_cookies VALUES ('theme', 'dark', 'www.coomer.st', '/', 4102444800000, 0, 0)",
+		"INSERT INTO moz_cookies VALUES ('other', 'x', '.kemono.cr', '/', 0, 0, 0)",
+	)
+
+	cookies, err := GetProfileCookies(Firefox, profile, "coomer.st")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Cookie{
+		{
+			Name:     "session",
+			Value:    "abc",
+			Domain:   "coomer.st",
+			Path:     "/",
+			Expires:  time.Unix(4102444800, 0),
+			Secure:   true,
+			HttpOnly: true,
+		},
+		{
+			Name:     "theme",
+			Value:    "dark",
+			Domain:   "www.coomer.st",
+			HostOnly: true,
+			Path:     "/",
+			Expires:  time.UnixMilli(4102444800000),
+		},
+	}, cookies)
+}
+
+func TestGetProfileCookies_Chromium(t *testing.T) {
+	keys := chromiumKeys("")
+	hostHash := sha256.Sum256([]byte(".coomer.st"))
+	otherHash := sha256.Sum256([]byte("coomer.st"))
+
+	profile := t.TempDir()
+	dbPath := filepath.Join(profile, "Network", "Cookies")
+	createDatabase(t, dbPath,
+		"CREATE TABLE meta (key TEXT, value TEXT)",
+		"INSERT INTO meta VALUES ('version', '24')",
+		"CREATE TABLE cookies (host_key TEXT, name TEXT, value TEXT, encrypted_value BLOB, path TEXT, "+
+			"expires_utc INTEGER, is_secure INTEGER, is_httponly INTEGER)",
+	)
+
+	db, _ := sql.Open("sqlite", dbPath)
+	insert := "INSERT INTO cookies VALUES (?, ?, ?, ?, '/', ?, 1, 0)"
+	db.Exec(insert, ".coomer.st", "session", "",
+		encryptChromiumValue("v10", keys.v10, append(hostHash[:], []byte("abc")...)), int64(13_000_000_000_000_000))
+	db.Exec(insert, "coomer.st", "empty-password", "",
+		encryptChromiumValue("v11", keys.v11[0], append(otherHash[:], []byte("def")...)), 0)
+	db.Exec(insert, "coomer.st", "plain", "ghi", []byte{}, 0)
+	db.Exec(insert, ".kemono.cr", "other", "x", []byte{}, 0)
+	db.Close()
+
+	cookies, err := GetProfileCookies(Chromium, profile, "coomer.st")
+
+	assert.NoError(t, err)
+	assert.Len(t, cookies, 3)
+	assert.Equal(t, "abc", cookies[0].Value)
+	assert.False(t, cookies[0].HostOnly)
+	assert.Equal(t, time.UnixMicro(13_000_000_000_000_000-chromiumEpoch*1_000_000), cookies[0].Expires)
+	assert.Equal(t, "def", cookies[1].Value)
+	assert.True(t, cookies[1].HostOnly)
+	assert.True(t, cookies[1].Expires.IsZero())
+	assert.Equal(t, "ghi", cookies[2].Value)
+}
+
+func TestDecryptChromiumValue_WrongKey(t *testing.T) {
+	encrypted := encryptChromiumValue("v11", chromiumKeys("keyring password").v11[0], []byte("secret"))
+
+	_, err := decryptChromiumValue(encrypted, chromiumKeys(""), nil)
+	assert.Error(t, err)
+
+	value, err := decryptChromiumValue(encrypted, chromiumKeys("keyring password"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(value))
+
+	// The prefix chooses the key, so a v10 value is never decrypted with the keyring key
+	encrypted = encryptChromiumValue("v10", chromiumKeys("keyring password").v11[0], []byte("secret"))
+	_, err = decryptChromiumValue(encrypted, chromiumKeys("keyring password"), nil)
+	assert.Error(t, err)
+}
+
+func TestDecryptChromiumValue_HostHash(t *testing.T) {
+	keys := chromiumKeys("")
+	hostHash := sha256.Sum256([]byte(".coomer.st"))
+	otherHash := sha256.Sum256([]byte(".kemono.cr"))
+
+	encrypted := encryptChromiumValue("v10", keys.v10, append(hostHash[:], []byte("secret")...))
+	value, err := decryptChromiumValue(encrypted, keys, hostHash[:])
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(value))
+
+	// A value that doesn't start with the hash of the host was decrypted with the wrong key, or belongs to another host
+	_, err = decryptChromiumValue(encrypted, keys, otherHash[:])
+	assert.Error(t, err)
+
+	encrypted = encryptChromiumValue("v10", keys.v10, []byte("secret"))
+	_, err = decryptChromiumValue(encrypted, keys, hostHash[:])
+	assert.Error(t, err)
+}
@@ -0,0 +1,542 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheExtension is the extension of the files in the cache directory.
+const cacheExtension = ".cache"
+
+// CacheOptions defines how the responses of GetText and GetResult are cached on the disk.
+type CacheOptions struct {
+	// Dir is the directory where the responses are saved; it's created if it doesn't exist. The files can only be read
+	// by the user, and never have the credentials sent in the requests.
+	Dir string
+
+	// TTL is how long a response is used without asking the server again, when the server doesn't say it with the
+	// Cache-Control or Expires headers. After that, responses with an ETag or Last-Modified header are revalidated with
+	// a conditional request, which doesn't transfer the body again if it didn't change.
+	TTL time.Duration
+
+	// MaxSize is the maximum number of bytes used by the cache; the least recently used responses are removed when
+	// it's exceeded. Zero means no limit.
+	MaxSize int64
+}
+
+// ClearCache removes all the responses saved in the cache set with WithCache.
+//
+// # Returns:
+//   - An error if the files of the cache can't be removed.
+func (f *Fetch) ClearCache() error {
+	if f.cache == nil {
+		return nil
+	}
+
+	return f.cache.clear()
+}
+
+// region - Private functions
+
+// cacheEntry is the metadata of a response saved in the cache; the body is saved after it, in the same file.
+type cacheEntry struct {
+	// Key identifies the entry; it's the URL, along with the credentials sent in the request, if any. It's never
+	// saved, so the credentials don't end up on the disk; the file only has its hash, in KeyHash
+	Key        string      `json:"-"`
+	KeyHash    string      `json:"keyHash"`
+	Url        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	StoredAt   time.Time   `json:"storedAt"`
+
+	// Vary has the values of the request headers listed in the Vary header of the response; see varyValue
+	Vary map[string]string `json:"vary,omitempty"`
+
+	body []byte
+}
+
+// httpCache is a size-bounded store of HTTP responses, with one file per key; see cacheKey.
+type httpCache struct {
+	options CacheOptions
+
+	mu      sync.Mutex
+	size    int64
+	scanned bool
+}
+
+func newHttpCache(options CacheOptions) *httpCache {
+	return &httpCache{options: options}
+}
+
+// load returns the entry saved with the key, or nil if there's none.
+func (c *httpCache) load(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	filePath := c.filePath(key)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+
+	header, body, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err = json.Unmarshal(header, &entry); err != nil || entry.KeyHash != hashKey(key) {
+		return nil
+	}
+
+	entry.Key = key
+	entry.body = body
+
+	// The modification time is used to find the least recently used entries
+	now := time.Now()
+	_ = os.Chtimes(filePath, now, now)
+
+	return &entry
+}
+
+// store saves the entry, removing the least recently used ones if the cache gets too big.
+func (c *httpCache) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.scan(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"dir":   c.options.Dir,
+		}).Warn("could not read the cache")
+
+		return
+	}
+
+	entry.KeyHash = hashKey(entry.Key)
+	header, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	data := append(append(header, '\n'), entry.body...)
+	if c.options.MaxSize > 0 && int64(len(data)) > c.options.MaxSize {
+		return
+	}
+
+	filePath := c.filePath(entry.Key)
+
+	var oldSize int64
+	if info, sErr := os.Stat(filePath); sErr == nil {
+		oldSize = info.Size()
+	}
+
+	// Write to a temporary file first, so an interrupted write doesn't leave a broken entry
+	tmpPath := filePath + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o600); err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   entry.Url,
+		}).Warn("could not save the response in the cache")
+
+		return
+	}
+
+	c.size += int64(len(data)) - oldSize
+	c.evict()
+}
+
+// remove deletes the entry saved with the key, if any.
+func (c *httpCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	filePath := c.filePath(key)
+	if info, err := os.Stat(filePath); err == nil && os.Remove(filePath) == nil {
+		c.size -= info.Size()
+	}
+}
+
+func (c *httpCache) clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err = os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove cache file: %w", err)
+		}
+	}
+
+	c.size = 0
+	return nil
+}
+
+// scan creates the cache directory and calculates the size of the cache, the first time it's used.
+func (c *httpCache) scan() error {
+	if c.scanned {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.options.Dir, 0o700); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		c.size += file.size
+	}
+
+	c.scanned = true
+	return nil
+}
+
+// evict removes the least recently used entries until the cache is within its maximum size.
+func (c *httpCache) evict() {
+	if c.options.MaxSize <= 0 || c.size <= c.options.MaxSize {
+		return
+	}
+
+	files, err := c.files()
+	if err != nil {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, file := range files {
+		if c.size <= c.options.MaxSize {
+			break
+		}
+
+		if os.Remove(file.path) == nil {
+			c.size -= file.size
+		}
+	}
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *httpCache) files() ([]cacheFile, error) {
+	entries, err := os.ReadDir(c.options.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not read directory: %w", err)
+	}
+
+	files := make([]cacheFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != cacheExtension {
+			continue
+		}
+
+		info, iErr := entry.Info()
+		if iErr != nil {
+			continue
+		}
+
+		files = append(files, cacheFile{
+			path:    filepath.Join(c.options.Dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+
+	return files, nil
+}
+
+func (c *httpCache) filePath(key string) string {
+	return filepath.Join(c.options.Dir, hashKey(key)+cacheExtension)
+}
+
+// cacheTransport is a http.RoundTripper that answers GET requests from the cache while they are fresh, and revalidates
+// them with conditional requests when they are stale.
+type cacheTransport struct {
+	base  http.RoundTripper
+	cache *httpCache
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasDirective(req.Header, "no-store") {
+		return t.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := t.cache.load(key)
+	if entry != nil && !entry.matches(req) {
+		entry = nil
+	}
+
+	if entry != nil && !hasDirective(req.Header, "no-cache") && entry.isFresh(t.cache.options.TTL) {
+		return entry.response(req), nil
+	}
+
+	// Ask the server if the saved response is still valid, unless the caller has its own conditions
+	outgoing := req
+	if entry != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outgoing = req.Clone(req.Context())
+			if etag != "" {
+				outgoing.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outgoing.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := t.base.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && outgoing != req {
+		resp.Body.Close()
+
+		// The new headers replace the saved ones, so the freshness is calculated again
+		for key, values := range storedHeader(resp.Header) {
+			entry.Header[key] = values
+		}
+
+		entry.StoredAt = time.Now()
+		if isCacheable(entry.Header, t.cache.options.TTL) {
+			t.cache.store(entry)
+		} else {
+			t.cache.remove(key)
+		}
+
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	if !isCacheable(resp.Header, t.cache.options.TTL) {
+		if entry != nil {
+			t.cache.remove(key)
+		}
+
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry = &cacheEntry{
+		Key:        key,
+		Url:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     storedHeader(resp.Header),
+		StoredAt:   time.Now(),
+		Vary:       varyValues(req, resp.Header),
+		body:       body,
+	}
+
+	t.cache.store(entry)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// matches checks if the request has the same values, in the headers listed in Vary, as the saved response.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for key, value := range e.Vary {
+		if key == "*" || varyValue(req, key) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isFresh checks if the saved response can be used without asking the server.
+func (e *cacheEntry) isFresh(ttl time.Duration) bool {
+	return time.Since(e.StoredAt) < freshness(e.Header, e.StoredAt, ttl)
+}
+
+// response creates a http.Response from the saved one.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// isCacheable checks if the response, with the given headers, can be saved: it must be allowed by the server, so it
+// can't be "no-store" or "private", and be fresh for some time, or have validators to be revalidated later.
+func isCacheable(header http.Header, ttl time.Duration) bool {
+	if hasDirective(header, "no-store") || hasDirective(header, "private") || header.Get("Vary") == "*" {
+		return false
+	}
+
+	if header.Get("ETag") != "" || header.Get("Last-Modified") != "" {
+		return true
+	}
+
+	return freshness(header, time.Now(), ttl) > 0
+}
+
+// credentialHeaders are the request headers with the credentials of the user.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// cacheKey returns the key of the request in the cache. Requests with credentials have their own entries, so the
+// responses of one user are never returned to another one.
+func cacheKey(req *http.Request) string {
+	key := req.URL.String()
+	for _, name := range credentialHeaders {
+		if value := req.Header.Get(name); value != "" {
+			key += "\n" + name + ": " + value
+		}
+	}
+
+	return key
+}
+
+// freshness returns how long a response is fresh, from the Cache-Control or Expires headers, or the TTL if the server
+// doesn't say it.
+func freshness(header http.Header, storedAt time.Time, ttl time.Duration) time.Duration {
+	if hasDirective(header, "no-cache") {
+		return 0
+	}
+
+	for _, directive := range cacheDirectives(header) {
+		if value, found := strings.CutPrefix(directive, "max-age="); found {
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil {
+				return 0
+			}
+
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+
+		date := storedAt
+		if sentAt, dErr := http.ParseTime(header.Get("Date")); dErr == nil {
+			date = sentAt
+		}
+
+		return expiresAt.Sub(date)
+	}
+
+	return ttl
+}
+
+// hasDirective checks if the Cache-Control header has the directive, like "no-store".
+func hasDirective(header http.Header, directive string) bool {
+	for _, d := range cacheDirectives(header) {
+		if d == directive {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cacheDirectives(header http.Header) []string {
+	directives := make([]string, 0)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if directive = strings.ToLower(strings.TrimSpace(directive)); directive != "" {
+				directives = append(directives, directive)
+			}
+		}
+	}
+
+	return directives
+}
+
+// hashKey returns the SHA-256 of the key, in hex; it's what identifies an entry on the disk.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// storedHeader returns a copy of the response headers to be saved in the cache, without the cookies set by the server.
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	stored.Del("Set-Cookie")
+	return stored
+}
+
+// varyValue returns the value of the request header that is saved in the Vary of an entry; credentials are hashed, so
+// they are never saved on the disk.
+func varyValue(req *http.Request, key string) string {
+	value := req.Header.Get(key)
+	if value != "" && slices.Contains(credentialHeaders, key) {
+		return hashKey(value)
+	}
+
+	return value
+}
+
+// varyValues returns the values of the request headers listed in the Vary header of the response.
+func varyValues(req *http.Request, header http.Header) map[string]string {
+	values := make(map[string]string)
+	for _, value := range header.Values("Vary") {
+		for _, key := range strings.Split(value, ",") {
+			if key = http.CanonicalHeaderKey(strings.TrimSpace(key)); key != "" {
+				values[key] = varyValue(req, key)
+			}
+		}
+	}
+
+	return values
+}
+
+// endregion
@@ -0,0 +1,217 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch_WithCache_Fresh(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"umd"}`))
+	}))
+	defer server.Close()
+
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: t.TempDir(), TTL: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		var result struct{ Name string }
+		_, err := fetch.GetResult(server.URL, nil, &result)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "umd", result.Name)
+	}
+
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Responses removed from the cache are requested again
+	assert.NoError(t, fetch.ClearCache())
+	_, _ = fetch.GetText(server.URL)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestFetch_WithCache_Revalidate(t *testing.T) {
+	var hits, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("page content"))
+	}))
+	defer server.Close()
+
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: t.TempDir(), TTL: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		text, err := fetch.GetText(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "page content", text)
+	}
+
+	assert.Equal(t, int32(3), hits.Load())
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestFetch_WithCache_NoStore(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: dir, TTL: time.Hour}))
+
+	_, _ = fetch.GetText(server.URL)
+	_, _ = fetch.GetText(server.URL)
+
+	files, _ := os.ReadDir(dir)
+	assert.Empty(t, files)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestFetch_WithCache_Private(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Write([]byte("private page"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: dir, TTL: time.Hour}))
+
+	_, _ = fetch.GetText(server.URL)
+	_, _ = fetch.GetText(server.URL)
+
+	files, _ := os.ReadDir(dir)
+	assert.Empty(t, files)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestFetch_WithCache_Credentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"` + r.Header.Get("Authorization") + `"}`))
+	}))
+	defer server.Close()
+
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: t.TempDir(), TTL: time.Hour}))
+
+	// Each user gets their own response, even though the URL is the same
+	for _, user := range []string{"alice", "bob", "alice"} {
+		var result struct{ Name string }
+		_, err := fetch.GetResult(server.URL, map[string]string{"Authorization": user}, &result)
+
+		assert.NoError(t, err)
+		assert.Equal(t, user, result.Name)
+	}
+}
+
+func TestFetch_WithCache_CredentialsNotSaved(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Authorization, Cookie")
+		w.Header().Set("Set-Cookie", "other=server-secret; Path=/other")
+		w.Write([]byte(`{"name":"umd"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: dir, TTL: time.Hour}))
+
+	var result struct{ Name string }
+	headers := map[string]string{"Authorization": "Bearer user-secret", "Cookie": "session=cookie-secret"}
+	_, err := fetch.GetResult(server.URL, headers, &result)
+	assert.NoError(t, err)
+
+	// The entry is saved, but only the hash of the credentials is in it, and only the user can read it
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	for _, file := range files {
+		data, _ := os.ReadFile(filepath.Join(dir, file.Name()))
+		assert.NotContains(t, string(data), "user-secret")
+		assert.NotContains(t, string(data), "cookie-secret")
+		assert.NotContains(t, string(data), "server-secret")
+
+		info, _ := file.Info()
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// The saved response is still used for the same user
+	_, err = fetch.GetResult(server.URL, headers, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "umd", result.Name)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestFetch_WithCache_MaxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1000)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithCache(CacheOptions{Dir: dir, TTL: time.Hour, MaxSize: 3000}))
+
+	for i := 0; i < 5; i++ {
+		_, err := fetch.GetText(fmt.Sprintf("%s/page/%d", server.URL, i))
+		assert.NoError(t, err)
+	}
+
+	var size int64
+	files, _ := os.ReadDir(dir)
+	for _, file := range files {
+		info, _ := os.Stat(filepath.Join(dir, file.Name()))
+		size += info.Size()
+	}
+
+	assert.Less(t, len(files), 5)
+	assert.LessOrEqual(t, size, int64(3000))
+
+	// The most recent page is still cached
+	cache := newHttpCache(CacheOptions{Dir: dir})
+	assert.NotNil(t, cache.load(server.URL+"/page/4"))
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Now()
+
+	header := http.Header{"Cache-Control": {"public, max-age=60"}}
+	assert.Equal(t, time.Minute, freshness(header, now, time.Hour))
+
+	header = http.Header{"Cache-Control": {"no-cache"}}
+	assert.Equal(t, time.Duration(0), freshness(header, now, time.Hour))
+
+	header = http.Header{
+		"Date":    {now.UTC().Format(http.TimeFormat)},
+		"Expires": {now.Add(2 * time.Hour).UTC().Format(http.TimeFormat)},
+	}
+	assert.Equal(t, 2*time.Hour, freshness(header, now, time.Hour))
+
+	assert.Equal(t, time.Hour, freshness(http.Header{}, now, time.Hour))
+}
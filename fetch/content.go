@@ -0,0 +1,321 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+// sniffLength is the number of bytes at the beginning of a file used to detect its content.
+const sniffLength = 512
+
+// ContentInfo is the type of content of a file, detected from its first bytes or from the Content-Type header.
+type ContentInfo struct {
+	// Extension is the extension of the file, in lower case and without the dot, like "jpg".
+	Extension string
+
+	// MimeType is the MIME type of the file, like "image/jpeg".
+	MimeType string
+
+	// Type is the type of media of the file.
+	Type model.MediaType
+}
+
+// contentTypes maps the MIME types that can be detected to their ContentInfo.
+var contentTypes = map[string]ContentInfo{
+	"image/jpeg":       {Extension: "jpg", MimeType: "image/jpeg", Type: model.Image},
+	"image/png":        {Extension: "png", MimeType: "image/png", Type: model.Image},
+	"image/gif":        {Extension: "gif", MimeType: "image/gif", Type: model.Image},
+	"image/webp":       {Extension: "webp", MimeType: "image/webp", Type: model.Image},
+	"image/avif":       {Extension: "avif", MimeType: "image/avif", Type: model.Image},
+	"image/heic":       {Extension: "heic", MimeType: "image/heic", Type: model.Image},
+	"image/heif":       {Extension: "heif", MimeType: "image/heif", Type: model.Image},
+	"video/mp4":        {Extension: "mp4", MimeType: "video/mp4", Type: model.Video},
+	"video/quicktime":  {Extension: "mov", MimeType: "video/quicktime", Type: model.Video},
+	"video/webm":       {Extension: "webm", MimeType: "video/webm", Type: model.Video},
+	"video/x-matroska": {Extension: "mkv", MimeType: "video/x-matroska", Type: model.Video},
+	"audio/mp4":        {Extension: "m4a", MimeType: "audio/mp4", Type: model.Unknown},
+}
+
+// isoBrands maps the brands of the ISO media file format to their MIME types.
+var isoBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "heim": "image/heic", "heis": "image/heic",
+	"mif1": "image/heif", "msf1": "image/heif",
+	"qt  ": "video/quicktime",
+	"isom": "video/mp4", "iso2": "video/mp4", "iso4": "video/mp4", "iso5": "video/mp4", "iso6": "video/mp4",
+	"mp41": "video/mp4", "mp42": "video/mp4", "avc1": "video/mp4", "dash": "video/mp4", "mmp4": "video/mp4",
+	"M4V ": "video/mp4",
+	"M4A ": "audio/mp4", "M4B ": "audio/mp4",
+}
+
+// DetectContent detects the type of content from the first bytes of a file, falling back to the Content-Type header
+// when the bytes don't match any known format. The supported formats are JPEG, PNG, GIF, WebP, AVIF, HEIC, HEIF, MP4,
+// MOV, WebM, MKV and M4A.
+//
+// # Parameters:
+//   - data: the first bytes of the file; 512 bytes are enough.
+//   - contentType: the value of the Content-Type header, or an empty string if it's unknown.
+//
+// # Returns:
+//   - The ContentInfo of the file.
+//   - A boolean indicating if the content was detected.
+func DetectContent(data []byte, contentType string) (ContentInfo, bool) {
+	if mimeType := sniffMimeType(data); mimeType != "" {
+		return contentTypes[mimeType], true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ContentInfo{}, false
+	}
+
+	info, exists := contentTypes[strings.ToLower(mediaType)]
+	return info, exists
+}
+
+// DetectFileContent detects the type of content of a file on the disk, from its first bytes.
+//
+// # Parameters:
+//   - filePath: the path of the file.
+//
+// # Returns:
+//   - The ContentInfo of the file.
+//   - An error if the file can't be read or its content is unknown.
+func DetectFileContent(filePath string) (ContentInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ContentInfo{}, fmt.Errorf("could not open file: %w", err)
+	}
+
+	defer file.Close()
+
+	data := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ContentInfo{}, fmt.Errorf("could not read file: %w", err)
+	}
+
+	info, detected := DetectContent(data[:n], "")
+	if !detected {
+		return ContentInfo{}, fmt.Errorf("unknown content in '%s'", filePath)
+	}
+
+	return info, nil
+}
+
+// ProbeContent detects the type of content of a remote file before it's downloaded, requesting only its first bytes.
+//
+// # Parameters:
+//   - url: the URL of the file.
+//
+// # Returns:
+//   - The ContentInfo of the file.
+//   - An error if the request fails or the content is unknown.
+func (f *Fetch) ProbeContent(url string) (ContentInfo, error) {
+	return f.ProbeContentContext(context.Background(), url)
+}
+
+// ProbeContentContext is like ProbeContent, but the request stops when the context is canceled.
+//
+// # Parameters:
+//   - ctx: the context of the request.
+//   - url: the URL of the file.
+//
+// # Returns:
+//   - The ContentInfo of the file.
+//   - An error if the request fails, the context is canceled or the content is unknown.
+func (f *Fetch) ProbeContentContext(ctx context.Context, url string) (ContentInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return ContentInfo{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range f.headers {
+		req.Header.Set(key, value)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", sniffLength-1))
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return ContentInfo{}, fmt.Errorf("request error: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ContentInfo{}, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	// Servers that don't support ranges send the whole file, so we only read what we need
+	data, err := io.ReadAll(io.LimitReader(resp.Body, sniffLength))
+	if err != nil {
+		return ContentInfo{}, fmt.Errorf("could not read response: %w", err)
+	}
+
+	info, detected := DetectContent(data, resp.Header.Get("Content-Type"))
+	if !detected {
+		return ContentInfo{}, fmt.Errorf("unknown content in '%s'", url)
+	}
+
+	return info, nil
+}
+
+// ProbeMedia is like ProbeContent, but it also corrects the Extension and Type of the media, which are derived from the
+// URL and may be wrong. It's useful before creating the requests with a PathTemplate that uses the extension.
+//
+// # Parameters:
+//   - media: the media to be corrected.
+//
+// # Returns:
+//   - An error if the request fails or the content is unknown; in that case the media is not changed.
+func (f *Fetch) ProbeMedia(media *model.Media) error {
+	return f.ProbeMediaContext(context.Background(), media)
+}
+
+// ProbeMediaContext is like ProbeMedia, but the request stops when the context is canceled.
+//
+// # Parameters:
+//   - ctx: the context of the request.
+//   - media: the media to be corrected.
+//
+// # Returns:
+//   - An error if the request fails, the context is canceled or the content is unknown; in that case the media is not
+//     changed.
+func (f *Fetch) ProbeMediaContext(ctx context.Context, media *model.Media) error {
+	info, err := f.ProbeContentContext(ctx, media.Url)
+	if err != nil {
+		return err
+	}
+
+	media.Extension = info.Extension
+	media.Type = info.Type
+	return nil
+}
+
+// DetectContent waits for the download to complete and detects the type of content of the downloaded file. The
+// Extension and Type of Request.Media, if any, are corrected.
+//
+// # Parameters:
+//   - rename: if true, the file is renamed to have the detected extension, like "video.gifv" to "video.mp4", and
+//     FilePath is updated. The sidecar of the file and its line in the manifest, if any, are moved along with
+//     it; see SidecarProcessor.
+//
+// # Returns:
+//   - The ContentInfo of the file.
+//   - An error if the download failed, its content is unknown or the file can't be renamed.
+func (r *Response) DetectContent(rename bool) (ContentInfo, error) {
+	if err := r.Error(); err != nil {
+		return ContentInfo{}, err
+	}
+
+	info, err := DetectFileContent(r.FilePath)
+	if err != nil {
+		return ContentInfo{}, err
+	}
+
+	if media := r.Request.Media; media != nil {
+		media.Extension = info.Extension
+		media.Type = info.Type
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(r.FilePath), "."))
+	if rename && !sameExtension(ext, info.Extension) {
+		newPath, rErr := reserveFilePath(strings.TrimSuffix(r.FilePath, filepath.Ext(r.FilePath)) + "." + info.Extension)
+		if rErr != nil {
+			return info, fmt.Errorf("could not rename file: %w", rErr)
+		}
+
+		if err = os.Rename(r.FilePath, newPath); err != nil {
+			os.Remove(newPath)
+			return info, fmt.Errorf("could not rename file: %w", err)
+		}
+
+		oldPath := r.FilePath
+		r.FilePath = newPath
+
+		if err = moveSidecar(oldPath, newPath); err != nil {
+			return info, fmt.Errorf("could not move sidecar: %w", err)
+		}
+	}
+
+	return info, nil
+}
+
+// region - Private functions
+
+// sniffMimeType returns the MIME type of the data, based on its magic bytes, or an empty string if it's unknown.
+func sniffMimeType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return sniffIsoMedia(data)
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// Matroska and WebM share the EBML header; the DocType tells them apart
+		if bytes.Contains(data[:min(len(data), 64)], []byte("webm")) {
+			return "video/webm"
+		}
+
+		return "video/x-matroska"
+	}
+
+	return ""
+}
+
+// sniffIsoMedia tells the formats based on the ISO media file format apart, using the brands in the ftyp box. The major
+// brand is checked before the compatible ones; files without any known brand are unknown.
+func sniffIsoMedia(data []byte) string {
+	boxSize := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	boxSize = min(max(boxSize, 16), len(data))
+
+	brands := []string{string(data[8:12])}
+	for i := 16; i+4 <= boxSize; i += 4 {
+		brands = append(brands, string(data[i:i+4]))
+	}
+
+	// AVIF files often have a generic HEIF major brand, like "mif1", so the AVIF brands are checked first
+	for _, brand := range brands {
+		if brand == "avif" || brand == "avis" {
+			return "image/avif"
+		}
+	}
+
+	for _, brand := range brands {
+		if mimeType, exists := isoBrands[brand]; exists {
+			return mimeType
+		}
+	}
+
+	return ""
+}
+
+// sameExtension checks if two extensions are the same, considering alternative spellings.
+func sameExtension(a string, b string) bool {
+	normalize := func(ext string) string {
+		if ext == "jpeg" || ext == "jpe" {
+			return "jpg"
+		}
+
+		return ext
+	}
+
+	return normalize(a) == normalize(b)
+}
+
+// endregion
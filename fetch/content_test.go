@@ -0,0 +1,157 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+var mp4Header = []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+
+func TestDetectContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		extension   string
+		mediaType   model.MediaType
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF", "", "jpg", model.Image},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00", "", "png", model.Image},
+		{"gif", "GIF89a\x01\x00", "", "gif", model.Image},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "", "webp", model.Image},
+		{"avif", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", "", "avif", model.Image},
+		{"avif compatible brand", "\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1avifmiaf", "", "avif", model.Image},
+		{"mp4", string(mp4Header), "", "mp4", model.Video},
+		{"mov", "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  ", "", "mov", model.Video},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", "", "heic", model.Image},
+		{"heif", "\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1miaf", "", "heif", model.Image},
+		{"m4a", "\x00\x00\x00\x1cftypM4A \x00\x00\x00\x00M4A mp42isom", "", "m4a", model.Unknown},
+		{"webm", "\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm", "", "webm", model.Video},
+		{"mkv", "\x1A\x45\xDF\xA3\xA3\x42\x86\x81\x01\x42\x82\x88matroska", "", "mkv", model.Video},
+		{"wrong content type", "\x89PNG\r\n\x1a\n\x00\x00", "image/jpeg", "png", model.Image},
+		{"content type fallback", "unknown", "video/mp4; codecs=avc1", "mp4", model.Video},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, detected := DetectContent([]byte(test.data), test.contentType)
+
+			assert.True(t, detected)
+			assert.Equal(t, test.extension, info.Extension)
+			assert.Equal(t, test.mediaType, info.Type)
+		})
+	}
+
+	_, detected := DetectContent([]byte("plain text"), "text/plain")
+	assert.False(t, detected)
+
+	// Unknown brands are not mistaken for MP4
+	_, detected = DetectContent([]byte("\x00\x00\x00\x14ftypcrx \x00\x00\x00\x00crx "), "")
+	assert.False(t, detected)
+}
+
+func TestFetch_ProbeMedia(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "bytes=0-511", r.Header.Get("Range"))
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write(mp4Header)
+	}))
+	defer server.Close()
+
+	media := model.NewMedia(server.URL+"/video.gifv", model.Reddit, nil)
+	assert.Equal(t, "gifv", media.Extension)
+
+	fetch := New(nil, 0)
+	err := fetch.ProbeMedia(&media)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mp4", media.Extension)
+	assert.Equal(t, model.Video, media.Type)
+}
+
+func TestResponse_DetectContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(mp4Header)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "video.gifv")
+
+	fetch := New(nil, 0)
+	media := model.NewMedia(server.URL+"/video.gifv", model.Reddit, nil)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	request.Media = &media
+
+	resp := fetch.DownloadFile(request)
+	info, err := resp.DetectContent(true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mp4", info.Extension)
+	assert.Equal(t, filepath.Join(dir, "video.mp4"), resp.FilePath)
+	assert.Equal(t, filePath, request.FilePath)
+	assert.Equal(t, "mp4", media.Extension)
+	assert.Equal(t, model.Video, media.Type)
+	assert.NoFileExists(t, filePath)
+	assert.FileExists(t, resp.FilePath)
+}
+
+func TestResponse_DetectContent_Sidecar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(mp4Header)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "video.gifv")
+
+	fetch := New(nil, 0, WithPostProcessors(SidecarProcessor(SidecarOptions{Manifest: true})))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+
+	resp := fetch.DownloadFile(request)
+	_, err := resp.DetectContent(true)
+	assert.NoError(t, err)
+
+	// The sidecar and the manifest follow the renamed file
+	sidecar, err := ReadSidecar(resp.FilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "video.mp4", sidecar.File)
+	assert.NoFileExists(t, filePath+SidecarSuffix)
+
+	manifest, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(manifest), `"file":"video.mp4"`)
+	assert.NotContains(t, string(manifest), "video.gifv")
+}
+
+func TestFetch_ProbeContentContext_Canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(mp4Header)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(nil, 0).ProbeContentContext(ctx, server.URL)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDetectFileContent_Unknown(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(filePath, []byte("plain text"), 0644)
+
+	_, err := DetectFileContent(filePath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,323 @@
+package fetch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is a http.CookieJar that keeps all the attributes of the cookies, so they are only sent to the hosts and
+// paths they belong to. Cookies received through Set-Cookie are added to the jar, and the jar can be exported back to
+// the Netscape format.
+type CookieJar struct {
+	mu          sync.Mutex
+	cookies     map[string]Cookie
+	persistPath string
+}
+
+// NewCookieJar creates a CookieJar with the given cookies. Cookies without a domain are ignored.
+//
+// # Parameters:
+//   - cookies: the initial cookies of the jar, like the ones returned by GetFileCookies or GetBrowserCookies.
+func NewCookieJar(cookies []Cookie) *CookieJar {
+	jar := &CookieJar{cookies: make(map[string]Cookie)}
+
+	for _, cookie := range cookies {
+		if cookie.Domain == "" {
+			continue
+		}
+
+		cookie.Domain = strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+
+		jar.cookies[cookieKey(cookie)] = cookie
+	}
+
+	return jar
+}
+
+// LoadCookieJar creates a CookieJar with the cookies in a file, in the Netscape or JSON format.
+//
+// # Parameters:
+//   - filePath: the path of the file with the cookies.
+//
+// # Returns:
+//   - The CookieJar with the cookies.
+//   - An error if the file can't be read or parsed.
+func LoadCookieJar(filePath string) (*CookieJar, error) {
+	cookies, err := GetFileCookies(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCookieJar(cookies), nil
+}
+
+// SetCookies implements http.CookieJar, saving the cookies received from the URL.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+
+	host := strings.ToLower(u.Hostname())
+	changed := false
+
+	for _, c := range cookies {
+		cookie := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   host,
+			HostOnly: true,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+
+		// A domain cookie is only accepted if the host belongs to that domain, and the domain is not a public suffix,
+		// like "co.uk" or "github.io"; a host that is itself a public suffix can only set host-only cookies
+		if domain := strings.ToLower(strings.TrimPrefix(c.Domain, ".")); domain != "" {
+			if !matchesHost(host, domain) || (!strings.Contains(domain, ".") && domain != host) {
+				continue
+			}
+
+			if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+				if domain != host {
+					continue
+				}
+			} else {
+				cookie.Domain = domain
+				cookie.HostOnly = false
+			}
+		}
+
+		if cookie.Path == "" || cookie.Path[0] != '/' {
+			cookie.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			cookie.Expires = time.Unix(1, 0)
+		case c.MaxAge > 0:
+			cookie.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			cookie.Expires = c.Expires
+		}
+
+		key := cookieKey(cookie)
+		if isExpired(cookie, time.Now()) {
+			delete(j.cookies, key)
+		} else {
+			j.cookies[key] = cookie
+		}
+
+		changed = true
+	}
+
+	persistPath := j.persistPath
+	j.mu.Unlock()
+
+	if changed && persistPath != "" {
+		if err := j.SaveNetscape(persistPath); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  persistPath,
+			}).Warn("failed to persist cookies")
+		}
+	}
+}
+
+// Cookies implements http.CookieJar, returning the cookies that must be sent to the URL.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	requestPath := u.EscapedPath()
+	if requestPath == "" {
+		requestPath = "/"
+	}
+
+	now := time.Now()
+	matches := make([]Cookie, 0)
+
+	for key, cookie := range j.cookies {
+		if isExpired(cookie, now) {
+			delete(j.cookies, key)
+			continue
+		}
+
+		if cookie.Secure && !secure {
+			continue
+		}
+
+		if cookie.HostOnly && host != cookie.Domain {
+			continue
+		}
+
+		if !cookie.HostOnly && !matchesHost(host, cookie.Domain) {
+			continue
+		}
+
+		if !matchesCookiePath(requestPath, cookie.Path) {
+			continue
+		}
+
+		matches = append(matches, cookie)
+	}
+
+	// Cookies with longer paths are sent first
+	sort.SliceStable(matches, func(a, b int) bool {
+		if len(matches[a].Path) != len(matches[b].Path) {
+			return len(matches[a].Path) > len(matches[b].Path)
+		}
+
+		return matches[a].Name < matches[b].Name
+	})
+
+	result := make([]*http.Cookie, 0, len(matches))
+	for _, cookie := range matches {
+		result = append(result, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	return result
+}
+
+// All returns all the cookies in the jar that are not expired.
+func (j *CookieJar) All() []Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	cookies := make([]Cookie, 0, len(j.cookies))
+
+	for _, cookie := range j.cookies {
+		if !isExpired(cookie, now) {
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	sort.Slice(cookies, func(a, b int) bool {
+		return cookieKey(cookies[a]) < cookieKey(cookies[b])
+	})
+
+	return cookies
+}
+
+// PersistTo makes the jar save all its cookies to a file, in the Netscape format, every time cookies are changed by a
+// server through Set-Cookie.
+//
+// # Parameters:
+//   - filePath: the path of the file; an empty string stops persisting the cookies.
+func (j *CookieJar) PersistTo(filePath string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.persistPath = filePath
+}
+
+// WriteNetscape writes all the cookies in the jar in the Netscape format, used by cookies.txt files.
+func (j *CookieJar) WriteNetscape(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(buffered, "# Netscape HTTP Cookie File")
+
+	for _, cookie := range j.All() {
+		domain := cookie.Domain
+		includeSubdomains := "FALSE"
+		if !cookie.HostOnly {
+			domain = "." + domain
+			includeSubdomains = "TRUE"
+		}
+
+		if cookie.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+
+		var expires int64
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Unix()
+		}
+
+		_, _ = fmt.Fprintf(buffered, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, includeSubdomains, cookie.Path,
+			strings.ToUpper(fmt.Sprint(cookie.Secure)), expires, cookie.Name, cookie.Value)
+	}
+
+	return buffered.Flush()
+}
+
+// SaveNetscape saves all the cookies in the jar to a file, in the Netscape format. The file is replaced atomically.
+func (j *CookieJar) SaveNetscape(filePath string) error {
+	temp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create cookie file: %w", err)
+	}
+
+	defer os.Remove(temp.Name())
+
+	if err = j.WriteNetscape(temp); err != nil {
+		temp.Close()
+		return fmt.Errorf("could not write cookie file: %w", err)
+	}
+
+	if err = temp.Close(); err != nil {
+		return fmt.Errorf("could not write cookie file: %w", err)
+	}
+
+	if err = os.Rename(temp.Name(), filePath); err != nil {
+		return fmt.Errorf("could not save cookie file: %w", err)
+	}
+
+	return nil
+}
+
+// Compile-time assertion to ensure the jar implements the http.CookieJar interface
+var _ http.CookieJar = (*CookieJar)(nil)
+
+// region - Private functions
+
+func cookieKey(cookie Cookie) string {
+	return cookie.Domain + ";" + cookie.Path + ";" + cookie.Name
+}
+
+func isExpired(cookie Cookie, now time.Time) bool {
+	return !cookie.Expires.IsZero() && !cookie.Expires.After(now)
+}
+
+// defaultCookiePath returns the directory of the request path, as defined in RFC 6265, section 5.1.4.
+func defaultCookiePath(requestPath string) string {
+	if requestPath == "" || requestPath[0] != '/' {
+		return "/"
+	}
+
+	index := strings.LastIndex(requestPath, "/")
+	if index == 0 {
+		return "/"
+	}
+
+	return requestPath[:index]
+}
+
+// matchesCookiePath checks if the request path matches the cookie path, as defined in RFC 6265, section 5.1.4.
+func matchesCookiePath(requestPath string, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+// endregion
@@ -2,25 +2,125 @@ package fetch
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/samber/lo"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// Cookie represents a key-value pair for a typical HTTP cookie.
+// httpOnlyPrefix marks HttpOnly cookies in the Netscape format.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// Cookie represents a typical HTTP cookie, with its attributes.
 type Cookie struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
+
+	// Domain is the domain of the cookie, without a leading dot.
+	Domain string `json:"domain,omitempty"`
+
+	// HostOnly is true when the cookie is only sent to Domain, and not to its subdomains.
+	HostOnly bool `json:"hostOnly,omitempty"`
+
+	// Path is the path of the cookie; it's sent to this path and its subpaths.
+	Path string `json:"path,omitempty"`
+
+	// Expires is when the cookie expires; the zero value means it's a session cookie.
+	Expires time.Time `json:"expires"`
+
+	// Secure is true when the cookie is only sent through HTTPS.
+	Secure bool `json:"secure,omitempty"`
+
+	// HttpOnly is true when the cookie is not available to JavaScript.
+	HttpOnly bool `json:"httpOnly,omitempty"`
+}
+
+// BrowserCookieOptions defines how GetBrowserCookies loads the page and decides when the cookies are ready.
+type BrowserCookieOptions struct {
+	// Selector is a CSS selector of an element that must be visible before the cookies are read, like
+	// "header.user-header".
+	Selector string
+
+	// CookieName is the name of a cookie that must exist before the cookies are read, like "cf_clearance".
+	CookieName string
+
+	// NetworkIdle waits until the page doesn't make any request for half a second before the cookies are read.
+	NetworkIdle bool
+
+	// Timeout is the maximum time to load the page and wait for the conditions above; the default is 30 seconds.
+	Timeout time.Duration
+
+	// UserAgent is the user agent of the browser; the default is the same one used by Fetch, since some cookies are
+	// only valid with the user agent that created them.
+	UserAgent string
+
+	// BrowserPath is the path of a Chromium-based browser installed locally; by default, a browser is downloaded.
+	BrowserPath string
+
+	// ProfileDir is the user data directory of the browser, used to reuse an existing session; by default, a temporary
+	// directory is created and removed when the browser is closed.
+	ProfileDir string
+
+	// ShowBrowser opens a visible browser window instead of running it headless, so challenges can be solved manually.
+	ShowBrowser bool
 }
 
-// GetBrowserCookies retrieves HTTP cookies from a given URL by navigating to the page using a headless browser.
-// It returns a slice of Cookie objects or an error if the process fails.
-func GetBrowserCookies(url string, element string) ([]Cookie, error) {
-	browser := rod.New().MustConnect()
+// GetBrowserCookies retrieves HTTP cookies from a given URL by navigating to the page using a browser, which is useful
+// for sites protected by JavaScript challenges. When no wait condition is set in the options, the cookies are read
+// once the page is loaded.
+//
+// # Parameters:
+//   - url: the URL of the page.
+//   - options: the settings of the browser and the conditions to wait for before reading the cookies.
+//
+// # Returns:
+//   - A slice of Cookie objects.
+//   - An error if the browser can't be launched or the conditions are not met before the timeout.
+func GetBrowserCookies(url string, options BrowserCookieOptions) ([]Cookie, error) {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	agent := options.UserAgent
+	if agent == "" {
+		agent = userAgent
+	}
+
+	l := launcher.New().Headless(!options.ShowBrowser)
+	if options.BrowserPath != "" {
+		l = l.Bin(options.BrowserPath)
+	}
+
+	if options.ProfileDir != "" {
+		l = l.UserDataDir(options.ProfileDir)
+	}
+
+	controlUrl, err := l.Launch()
+	if err != nil {
+		return nil, fmt.Errorf("could not launch browser: %w", err)
+	}
+
+	// Only temporary profiles are removed
+	defer func() {
+		l.Kill()
+		if options.ProfileDir == "" {
+			l.Cleanup()
+		}
+	}()
+
+	browser := rod.New().ControlURL(controlUrl)
+	if err = browser.Connect(); err != nil {
+		return nil, fmt.Errorf("could not connect to browser: %w", err)
+	}
+
 	defer browser.Close()
 
 	page, err := browser.Page(proto.TargetCreateTarget{})
@@ -30,41 +130,153 @@ func GetBrowserCookies(url string, element string) ([]Cookie, error) {
 
 	defer page.Close()
 
-	err = page.Timeout(10 * time.Second).Navigate(url)
-	if err != nil {
+	page = page.Timeout(timeout)
+
+	if err = page.SetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: agent}); err != nil {
+		return nil, fmt.Errorf("could not set user agent: %w", err)
+	}
+
+	var waitIdle func()
+	if options.NetworkIdle {
+		waitIdle = page.WaitRequestIdle(500*time.Millisecond, nil, nil, nil)
+	}
+
+	if err = page.Navigate(url); err != nil {
 		return nil, fmt.Errorf("could not navigate: %w", err)
 	}
 
-	el, err := page.Timeout(10 * time.Second).Element("header.user-header")
-	if err == nil {
-		el.MustWaitVisible()
-		return extractCookies(page)
+	if err = page.WaitLoad(); err != nil {
+		return nil, fmt.Errorf("could not load page: %w", err)
 	}
 
-	waitNav := page.Timeout(10 * time.Second).WaitNavigation(proto.PageLifecycleEventNameLoad)
-	waitNav()
+	if waitIdle != nil {
+		waitIdle()
+	}
 
-	el, err = page.Timeout(10 * time.Second).Element("header.user-header")
-	if err != nil {
-		return nil, fmt.Errorf("could not find element: %w", err)
+	if options.Selector != "" {
+		if err = waitVisible(page, options.Selector); err != nil {
+			return nil, fmt.Errorf("could not find element '%s': %w", options.Selector, err)
+		}
+	}
+
+	if options.CookieName != "" {
+		if err = waitCookie(page, options.CookieName); err != nil {
+			return nil, fmt.Errorf("could not find cookie '%s': %w", options.CookieName, err)
+		}
 	}
 
 	return extractCookies(page)
 }
 
+// GetFileCookies reads the cookies, with all their attributes, from a file exported by a browser. It supports the
+// Netscape format, used by cookies.txt files, and JSON exports, like the ones created by browser extensions.
+//
+// # Parameters:
+//   - filePath: the path of the file with the cookies.
+//
+// # Returns:
+//   - A slice of Cookie objects.
+//   - An error if the file can't be read or parsed.
 func GetFileCookies(filePath string) ([]Cookie, error) {
-	cookies := make([]Cookie, 0)
-
-	f, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseJsonCookies(trimmed)
+	}
+
+	return parseNetscapeCookies(data), nil
+}
+
+// CookiesToHeader converts a slice of Cookie objects into a single HTTP header string in the "key=value" format.
+//
+// All cookies are added to the header, regardless of their domain and path; use a CookieJar to send only the cookies
+// that belong to each host.
+func CookiesToHeader(cookies []Cookie) string {
+	parts := lo.Map(cookies, func(cookie Cookie, index int) string {
+		return fmt.Sprintf("%s=%s", cookie.Name, cookie.Value)
+	})
+
+	return strings.Join(parts, "; ")
+}
+
+// region - Private functions
+
+// waitVisible waits until an element is visible, even if the page navigates to another URL while we wait, which is what
+// happens after a JavaScript challenge is solved.
+func waitVisible(page *rod.Page, selector string) error {
+	for {
+		el, err := page.Element(selector)
+		if err == nil {
+			if err = el.WaitVisible(); err == nil {
+				return nil
+			}
+		}
+
+		if ctxErr := page.GetContext().Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// waitCookie waits until the page has a cookie with the given name.
+func waitCookie(page *rod.Page, name string) error {
+	for {
+		cookies, err := page.Cookies(nil)
+		if err == nil && lo.ContainsBy(cookies, func(cookie *proto.NetworkCookie) bool { return cookie.Name == name }) {
+			return nil
+		}
+
+		if ctxErr := page.GetContext().Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func extractCookies(page *rod.Page) ([]Cookie, error) {
+	rodCookies, err := page.Cookies(nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get cookies: %w", err)
+	}
+
+	return lo.Map(rodCookies, func(cookie *proto.NetworkCookie, index int) Cookie {
+		var expires time.Time
+		if !cookie.Session && cookie.Expires > 0 {
+			expires = cookie.Expires.Time()
+		}
+
+		return Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   strings.TrimPrefix(cookie.Domain, "."),
+			HostOnly: !strings.HasPrefix(cookie.Domain, "."),
+			Path:     cookie.Path,
+			Expires:  expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HTTPOnly,
+		}
+	}), nil
+}
+
+// parseNetscapeCookies parses cookies in the Netscape format, where each line has 7 TAB-separated fields: domain,
+// include subdomains, path, secure, expiration, name and value.
+func parseNetscapeCookies(data []byte) []Cookie {
+	cookies := make([]Cookie, 0)
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// HttpOnly cookies are prefixed with #HttpOnly_, so they look like comments to older parsers
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
 
 		// Skip comments & blank lines
 		if len(line) == 0 || line[0] == '#' {
@@ -77,39 +289,79 @@ func GetFileCookies(filePath string) ([]Cookie, error) {
 			continue
 		}
 
-		name := parts[5]
-		value := parts[6]
+		var expires time.Time
+		if seconds, err := strconv.ParseInt(parts[4], 10, 64); err == nil && seconds > 0 {
+			expires = time.Unix(seconds, 0)
+		}
 
 		cookies = append(cookies, Cookie{
-			Name:  name,
-			Value: value,
+			Name:     parts[5],
+			Value:    parts[6],
+			Domain:   strings.TrimPrefix(parts[0], "."),
+			HostOnly: !strings.EqualFold(parts[1], "TRUE"),
+			Path:     parts[2],
+			Expires:  expires,
+			Secure:   strings.EqualFold(parts[3], "TRUE"),
+			HttpOnly: httpOnly,
 		})
 	}
 
-	return cookies, nil
+	return cookies
 }
 
-// CookiesToHeader converts a slice of Cookie objects into a single HTTP header string in the "key=value" format.
-func CookiesToHeader(cookies []Cookie) string {
-	parts := lo.Map(cookies, func(cookie Cookie, index int) string {
-		return fmt.Sprintf("%s=%s", cookie.Name, cookie.Value)
-	})
-
-	return strings.Join(parts, "; ")
+// jsonCookie is a cookie exported by browser extensions, like Cookie-Editor and EditThisCookie.
+type jsonCookie struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Domain         string  `json:"domain"`
+	HostOnly       *bool   `json:"hostOnly"`
+	Path           string  `json:"path"`
+	ExpirationDate float64 `json:"expirationDate"`
+	Expires        float64 `json:"expires"`
+	Session        bool    `json:"session"`
+	Secure         bool    `json:"secure"`
+	HttpOnly       bool    `json:"httpOnly"`
 }
 
-// region - Private functions
+// parseJsonCookies parses cookies exported in JSON; the export can be a list of cookies or an object with a list of
+// cookies in the field "cookies".
+func parseJsonCookies(data []byte) ([]Cookie, error) {
+	var list []jsonCookie
 
-func extractCookies(page *rod.Page) ([]Cookie, error) {
-	rodCookies, err := page.Cookies(nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not get cookies: %w", err)
+	if data[0] == '{' {
+		var wrapper struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("could not parse cookies: %w", err)
+		}
+
+		list = wrapper.Cookies
+	} else if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("could not parse cookies: %w", err)
 	}
 
-	return lo.Map(rodCookies, func(cookie *proto.NetworkCookie, index int) Cookie {
+	return lo.Map(list, func(c jsonCookie, _ int) Cookie {
+		hostOnly := !strings.HasPrefix(c.Domain, ".")
+		if c.HostOnly != nil {
+			hostOnly = *c.HostOnly
+		}
+
+		var expires time.Time
+		if seconds := max(c.ExpirationDate, c.Expires); !c.Session && seconds > 0 {
+			expires = time.Unix(int64(seconds), 0)
+		}
+
 		return Cookie{
-			Name:  cookie.Name,
-			Value: cookie.Value,
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   strings.TrimPrefix(c.Domain, "."),
+			HostOnly: hostOnly,
+			Path:     c.Path,
+			Expires:  expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
 		}
 	}), nil
 }
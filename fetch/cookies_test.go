@@ -0,0 +1,185 @@
+package fetch
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const netscapeCookies = "# Netscape HTTP Cookie File\n" +
+	".example.com\tTRUE\t/\tTRUE\t4102444800\tsession\tabc\n" +
+	"#HttpOnly_www.example.com\tFALSE\t/account\tFALSE\t0\ttoken\txyz\n" +
+	"# a comment\n" +
+	"invalid line\n"
+
+func TestGetFileCookies_Netscape(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(filePath, []byte(netscapeCookies), 0644)
+
+	cookies, err := GetFileCookies(filePath)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Cookie{
+		{
+			Name:    "session",
+			Value:   "abc",
+			Domain:  "example.com",
+			Path:    "/",
+			Expires: time.Unix(4102444800, 0),
+			Secure:  true,
+		},
+		{
+			Name:     "token",
+			Value:    "xyz",
+			Domain:   "www.example.com",
+			HostOnly: true,
+			Path:     "/account",
+			HttpOnly: true,
+		},
+	}, cookies)
+}
+
+func TestGetFileCookies_Json(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(filePath, []byte(`[
+		{"name": "session", "value": "abc", "domain": ".example.com", "hostOnly": false, "path": "/",
+		 "expirationDate": 4102444800.5, "secure": true, "httpOnly": true, "session": false},
+		{"name": "theme", "value": "dark", "domain": "example.com", "hostOnly": true, "path": "/", "session": true}
+	]`), 0644)
+
+	cookies, err := GetFileCookies(filePath)
+
+	assert.NoError(t, err)
+	assert.Len(t, cookies, 2)
+	assert.Equal(t, "example.com", cookies[0].Domain)
+	assert.False(t, cookies[0].HostOnly)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, int64(4102444800), cookies[0].Expires.Unix())
+	assert.True(t, cookies[1].HostOnly)
+	assert.True(t, cookies[1].Expires.IsZero())
+}
+
+func TestCookieJar_Scoping(t *testing.T) {
+	jar := NewCookieJar([]Cookie{
+		{Name: "domain", Value: "1", Domain: "example.com", Path: "/"},
+		{Name: "host", Value: "2", Domain: "example.com", HostOnly: true, Path: "/"},
+		{Name: "secure", Value: "3", Domain: "example.com", Path: "/", Secure: true},
+		{Name: "account", Value: "4", Domain: "example.com", Path: "/account"},
+		{Name: "expired", Value: "5", Domain: "example.com", Path: "/", Expires: time.Now().Add(-time.Hour)},
+		{Name: "other", Value: "6", Domain: "other.com", Path: "/"},
+	})
+
+	names := func(rawUrl string) []string {
+		u, _ := url.Parse(rawUrl)
+		result := make([]string, 0)
+		for _, cookie := range jar.Cookies(u) {
+			result = append(result, cookie.Name)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"domain", "host"}, names("http://example.com/"))
+	assert.Equal(t, []string{"domain", "secure"}, names("https://www.example.com/page"))
+	assert.Equal(t, []string{"account", "domain", "host", "secure"}, names("https://example.com/account/settings"))
+	assert.Equal(t, []string{"domain", "host"}, names("http://example.com/accounts"))
+	assert.Equal(t, []string{}, names("http://notexample.com/"))
+}
+
+func TestCookieJar_SetCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", HttpOnly: true})
+			http.SetCookie(w, &http.Cookie{Name: "old", Value: "", MaxAge: -1})
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte(cookie.Value))
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	jar := NewCookieJar([]Cookie{{Name: "old", Value: "1", Domain: host.Hostname(), HostOnly: true, Path: "/"}})
+
+	persistPath := filepath.Join(t.TempDir(), "cookies.txt")
+	jar.PersistTo(persistPath)
+
+	fetch := New(nil, 0, WithCookieJar(jar))
+	_, err := fetch.GetText(server.URL + "/login")
+	assert.NoError(t, err)
+
+	body, err := fetch.GetText(server.URL + "/profile")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", body)
+
+	// The cookies changed by the server are saved to the file
+	saved, err := GetFileCookies(persistPath)
+	assert.NoError(t, err)
+	assert.Len(t, saved, 1)
+	assert.Equal(t, "session", saved[0].Name)
+	assert.True(t, saved[0].HttpOnly)
+	assert.True(t, saved[0].HostOnly)
+}
+
+func TestCookieJar_SetCookiesPublicSuffix(t *testing.T) {
+	jar := NewCookieJar(nil)
+
+	u, _ := url.Parse("https://www.example.co.uk/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "suffix", Value: "1", Domain: "co.uk"},
+		{Name: "domain", Value: "2", Domain: ".example.co.uk"},
+	})
+
+	// Cookies for a public suffix are rejected, so other sites under it don't receive them
+	other, _ := url.Parse("https://www.other.co.uk/")
+	assert.Empty(t, jar.Cookies(other))
+
+	cookies := jar.Cookies(u)
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "domain", cookies[0].Name)
+}
+
+func TestCookieJar_WriteNetscape(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(filePath, []byte(netscapeCookies), 0644)
+
+	jar, err := LoadCookieJar(filePath)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	err = jar.WriteNetscape(&buffer)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Cookie{
+		{
+			Name:    "session",
+			Value:   "abc",
+			Domain:  "example.com",
+			Path:    "/",
+			Expires: time.Unix(4102444800, 0),
+			Secure:  true,
+		},
+		{
+			Name:     "token",
+			Value:    "xyz",
+			Domain:   "www.example.com",
+			HostOnly: true,
+			Path:     "/account",
+			HttpOnly: true,
+		},
+	}, parseNetscapeCookies(buffer.Bytes()))
+}
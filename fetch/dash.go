@@ -0,0 +1,410 @@
+package fetch
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDashSegments is the maximum number of segments of a DASH track; manifests with more are considered invalid, so a
+// broken manifest can't make the download use all the memory.
+const maxDashSegments = 100_000
+
+// mpd is a DASH manifest; only the elements needed to find the segments are parsed.
+type mpd struct {
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseUrl  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration       string             `xml:"duration,attr"`
+	BaseUrl        string             `xml:"BaseURL"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType        string              `xml:"mimeType,attr"`
+	ContentType     string              `xml:"contentType,attr"`
+	BaseUrl         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	Id              string              `xml:"id,attr"`
+	Bandwidth       int64               `xml:"bandwidth,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	BaseUrl         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+}
+
+type mpdSegmentTemplate struct {
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+	StartNumber    *int64 `xml:"startNumber,attr"`
+	Timescale      int64  `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timeline       []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int64  `xml:"r,attr"`
+	} `xml:"SegmentTimeline>S"`
+}
+
+type mpdSegmentList struct {
+	Initialization *struct {
+		SourceUrl string `xml:"sourceURL,attr"`
+		Range     string `xml:"range,attr"`
+	} `xml:"Initialization"`
+	SegmentUrls []struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// templateIdentifier matches the identifiers of a segment template, like "$Number%05d$".
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time)(%0(\d+)d)?\$`)
+
+// isoDuration matches a duration in the ISO 8601 format, like "PT1H2M3.5S".
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// region - Private functions
+
+// dashTracks returns the video and audio tracks with the highest bandwidth in the first period of the DASH manifest.
+func dashTracks(manifestUrl string, manifest string) (*streamTrack, *streamTrack, error) {
+	var doc mpd
+	if err := xml.Unmarshal([]byte(manifest), &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid DASH manifest: %w", err)
+	}
+
+	if len(doc.Periods) == 0 {
+		return nil, nil, fmt.Errorf("no periods found in the DASH manifest")
+	}
+
+	period := doc.Periods[0]
+
+	durationStr := period.Duration
+	if durationStr == "" {
+		durationStr = doc.Duration
+	}
+
+	duration := parseIsoDuration(durationStr)
+
+	base, err := url.Parse(manifestUrl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest URL '%s': %w", manifestUrl, err)
+	}
+
+	// BaseURL elements are relative to the ones in the parent elements
+	for _, ref := range []string{doc.BaseUrl, period.BaseUrl} {
+		if base, err = resolveBase(base, ref); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var video, audio *streamTrack
+
+	for _, set := range period.AdaptationSets {
+		setBase, sErr := resolveBase(base, set.BaseUrl)
+		if sErr != nil {
+			return nil, nil, sErr
+		}
+
+		for _, rep := range set.Representations {
+			kind := dashContentType(set, rep)
+			if kind != "video" && kind != "audio" {
+				continue
+			}
+
+			current := video
+			if kind == "audio" {
+				current = audio
+			}
+
+			if current != nil && current.bandwidth >= rep.Bandwidth {
+				continue
+			}
+
+			track, tErr := dashTrack(setBase, set, rep, duration)
+			if tErr != nil {
+				return nil, nil, tErr
+			}
+
+			if kind == "video" {
+				video = track
+			} else {
+				audio = track
+			}
+		}
+	}
+
+	if video == nil && audio == nil {
+		return nil, nil, fmt.Errorf("no video or audio found in the DASH manifest")
+	}
+
+	return video, audio, nil
+}
+
+// dashContentType returns "video" or "audio", based on the attributes of the adaptation set and representation.
+func dashContentType(set mpdAdaptationSet, rep mpdRepresentation) string {
+	if set.ContentType != "" {
+		return set.ContentType
+	}
+
+	mimeType := rep.MimeType
+	if mimeType == "" {
+		mimeType = set.MimeType
+	}
+
+	kind, _, _ := strings.Cut(mimeType, "/")
+	return kind
+}
+
+// dashTrack finds the segments of the representation, using its SegmentTemplate, SegmentList or, when it has neither,
+// the file in its BaseURL.
+func dashTrack(base *url.URL, set mpdAdaptationSet, rep mpdRepresentation, duration float64) (*streamTrack, error) {
+	base, err := resolveBase(base, rep.BaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &streamTrack{bandwidth: rep.Bandwidth}
+
+	template := rep.SegmentTemplate
+	if template == nil {
+		template = set.SegmentTemplate
+	}
+
+	list := rep.SegmentList
+	if list == nil {
+		list = set.SegmentList
+	}
+
+	switch {
+	case template != nil:
+		err = dashTemplateSegments(track, base, template, rep, duration)
+	case list != nil:
+		err = dashListSegments(track, base, list)
+	default:
+		track.segments = []streamSegment{{url: base.String(), length: -1}}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(track.segments) == 0 {
+		return nil, fmt.Errorf("no segments found for representation '%s'", rep.Id)
+	}
+
+	return track, nil
+}
+
+func dashTemplateSegments(
+	track *streamTrack,
+	base *url.URL,
+	template *mpdSegmentTemplate,
+	rep mpdRepresentation,
+	duration float64,
+) error {
+	number := int64(1)
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+
+	timescale := max(template.Timescale, 1)
+
+	if template.Initialization != "" {
+		resolved, err := resolveUrl(base, expandTemplate(template.Initialization, rep, 0, 0))
+		if err != nil {
+			return err
+		}
+
+		track.init = &streamSegment{url: resolved, length: -1}
+	}
+
+	addSegment := func(time int64) error {
+		if len(track.segments) >= maxDashSegments {
+			return fmt.Errorf("representation '%s' has more than %d segments", rep.Id, maxDashSegments)
+		}
+
+		resolved, err := resolveUrl(base, expandTemplate(template.Media, rep, number, time))
+		if err != nil {
+			return err
+		}
+
+		track.segments = append(track.segments, streamSegment{url: resolved, length: -1})
+		number++
+		return nil
+	}
+
+	if len(template.Timeline) > 0 {
+		end := int64(duration * float64(timescale))
+
+		var time int64
+		for i, s := range template.Timeline {
+			if s.T != nil {
+				time = *s.T
+			}
+
+			if s.D <= 0 {
+				return fmt.Errorf("invalid segment duration %d in representation '%s'", s.D, rep.Id)
+			}
+
+			// A negative repeat count repeats the segment until the next one, or until the end of the period
+			repeat := s.R
+			if repeat < 0 {
+				limit := end
+				if i+1 < len(template.Timeline) && template.Timeline[i+1].T != nil {
+					limit = *template.Timeline[i+1].T
+				}
+
+				repeat = int64(math.Ceil(float64(limit-time)/float64(s.D))) - 1
+			}
+
+			for r := int64(0); r <= repeat; r++ {
+				if err := addSegment(time); err != nil {
+					return err
+				}
+
+				time += s.D
+			}
+		}
+
+		return nil
+	}
+
+	if template.Duration <= 0 || duration <= 0 {
+		return fmt.Errorf("can't find the number of segments of representation '%s'", rep.Id)
+	}
+
+	segments := math.Ceil(duration * float64(timescale) / float64(template.Duration))
+	if segments > maxDashSegments {
+		return fmt.Errorf("representation '%s' has more than %d segments", rep.Id, maxDashSegments)
+	}
+
+	count := int64(segments)
+	for i := int64(0); i < count; i++ {
+		if err := addSegment(i * template.Duration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func dashListSegments(track *streamTrack, base *url.URL, list *mpdSegmentList) error {
+	newSegment := func(ref string, byteRange string) (streamSegment, error) {
+		resolved := base.String()
+		if ref != "" {
+			var err error
+			if resolved, err = resolveUrl(base, ref); err != nil {
+				return streamSegment{}, err
+			}
+		}
+
+		segment := streamSegment{url: resolved, length: -1}
+		if byteRange != "" {
+			first, last, found := strings.Cut(byteRange, "-")
+			start, sErr := strconv.ParseInt(first, 10, 64)
+			end, eErr := strconv.ParseInt(last, 10, 64)
+			if !found || sErr != nil || eErr != nil || end < start {
+				return streamSegment{}, fmt.Errorf("invalid byte range '%s'", byteRange)
+			}
+
+			segment.offset = start
+			segment.length = end - start + 1
+		}
+
+		return segment, nil
+	}
+
+	if list.Initialization != nil {
+		init, err := newSegment(list.Initialization.SourceUrl, list.Initialization.Range)
+		if err != nil {
+			return err
+		}
+
+		track.init = &init
+	}
+
+	for _, segmentUrl := range list.SegmentUrls {
+		segment, err := newSegment(segmentUrl.Media, segmentUrl.MediaRange)
+		if err != nil {
+			return err
+		}
+
+		track.segments = append(track.segments, segment)
+	}
+
+	return nil
+}
+
+// expandTemplate replaces the identifiers in a segment template, like "$RepresentationID$/$Number%05d$.m4s".
+func expandTemplate(template string, rep mpdRepresentation, number int64, time int64) string {
+	expanded := templateIdentifier.ReplaceAllStringFunc(template, func(match string) string {
+		groups := templateIdentifier.FindStringSubmatch(match)
+
+		var value string
+		switch groups[1] {
+		case "RepresentationID":
+			return rep.Id
+		case "Number":
+			value = strconv.FormatInt(number, 10)
+		case "Bandwidth":
+			value = strconv.FormatInt(rep.Bandwidth, 10)
+		case "Time":
+			value = strconv.FormatInt(time, 10)
+		}
+
+		if width, err := strconv.Atoi(groups[3]); err == nil && len(value) < width {
+			value = strings.Repeat("0", width-len(value)) + value
+		}
+
+		return value
+	})
+
+	return strings.ReplaceAll(expanded, "$$", "$")
+}
+
+// resolveBase resolves a BaseURL element; an empty element keeps the current base.
+func resolveBase(base *url.URL, ref string) (*url.URL, error) {
+	if strings.TrimSpace(ref) == "" {
+		return base, nil
+	}
+
+	resolved, err := resolveUrl(base, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Parse(resolved)
+}
+
+// parseIsoDuration parses a duration in the ISO 8601 format, like "PT1H2M3.5S", returning the number of seconds. It
+// returns zero if the duration is not valid.
+func parseIsoDuration(value string) float64 {
+	groups := isoDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if groups == nil {
+		return 0
+	}
+
+	var seconds float64
+	for i, multiplier := range []float64{86400, 3600, 60, 1} {
+		if groups[i+1] != "" {
+			v, _ := strconv.ParseFloat(groups[i+1], 64)
+			seconds += v * multiplier
+		}
+	}
+
+	return seconds
+}
+
+// endregion
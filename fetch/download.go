@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -49,6 +51,27 @@ func (f *Fetch) NewRequest(url string, filePath string) (*Request, error) {
 // Returns:
 //   - A Response object that contains the status and details of the download process.
 func (f *Fetch) DownloadFile(request *Request) *Response {
+	return f.downloadFile(request, f.existingFilePolicy(request))
+}
+
+// DownloadFiles downloads multiple files concurrently.
+//
+// Parameters:
+//   - requests: a slice of *Request objects representing the files to download.
+//   - parallel: the maximum number of concurrent downloads.
+//
+// Returns:
+//   - A channel of *Response objects, where each response corresponds to a file download.
+//   - A function that can be called to cancel all downloads.
+func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Response, func()) {
+	result, cancelAll, _ := f.downloadAll(requests, parallel, nil)
+	return result, cancelAll
+}
+
+// region - Private functions
+
+// downloadFile downloads the file of the request, using the given policy when the file already exists.
+func (f *Fetch) downloadFile(request *Request, policy ExistingFilePolicy) *Response {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Tie the http.Request to the context.
@@ -56,22 +79,110 @@ func (f *Fetch) DownloadFile(request *Request) *Response {
 	request.httpReq = request.httpReq.WithContext(ctx)
 
 	response := &Response{
-		Request: request,
-		Done:    make(chan struct{}, 1),
-		cancel:  cancel,
+		Request:  request,
+		FilePath: request.FilePath,
+		Done:     make(chan struct{}, 1),
+
+		cancel:    cancel,
+		bandwidth: newBandwidthLimiter(request.BandwidthLimit),
+		meter:     newSpeedMeter(),
 	}
 
 	go func() {
 		defer close(response.Done)
 
-		// How many bytes are already on the disk?
+		// The post processors run after the file is closed
+		defer f.postProcess(ctx, response)
+
+		var expected *checksum
+		if request.ExpectedHash != "" {
+			var err error
+			if expected, err = parseHash(request.ExpectedHash); err != nil {
+				response.err = err
+				return
+			}
+		}
+
+		// Files with mirrors are downloaded from the fastest one
+		mirrors := f.newMirrorList(request)
+		if err := useMirror(request, mirrors); err != nil {
+			response.err = err
+			return
+		}
+
+		// Create the directories in the path, in case they don't exist
+		if err := os.MkdirAll(filepath.Dir(response.FilePath), 0o755); err != nil {
+			response.err = fmt.Errorf("could not create directory: %w", err)
+			return
+		}
+
+		// How many bytes are already on the disk? They are only reused when we have the validators saved by a previous
+		// attempt to download the same URL; otherwise we can't be sure the data belongs to the same remote file.
+		state := loadResumeState(response.FilePath)
+
+		// The new name is reserved right away, so concurrent downloads to the same path don't pick the same name
+		if policy == ExistingFileRename && !(fileExists(response.FilePath) && state.canResume(request.Url)) {
+			filePath, err := reserveFilePath(response.FilePath)
+			if err != nil {
+				response.err = fmt.Errorf("could not create file: %w", err)
+				return
+			}
+
+			response.FilePath = filePath
+			state = nil
+		}
+
+		if info, err := os.Stat(response.FilePath); err == nil {
+			resumable := state.canResume(request.Url)
+
+			switch policy {
+			case ExistingFileSkip:
+				if !resumable && f.isSameFile(ctx, response, info.Size(), expected) {
+					log.WithFields(log.Fields{
+						"file": response.FilePath,
+						"url":  request.Url,
+					}).Debug("file already exists; skipping download")
+
+					response.size.Store(info.Size())
+					response.downloaded.Store(info.Size())
+					response.Skipped = true
+					return
+				}
+
+				if !resumable {
+					log.WithFields(log.Fields{
+						"file": response.FilePath,
+						"url":  request.Url,
+					}).Warn("existing file doesn't match the remote file; downloading it again")
+				}
+
+			case ExistingFileResume:
+				if !resumable && f.isCompleteFile(ctx, response, info.Size(), expected) {
+					log.WithFields(log.Fields{
+						"file": response.FilePath,
+						"url":  request.Url,
+					}).Debug("file already downloaded; skipping download")
+
+					response.size.Store(info.Size())
+					response.downloaded.Store(info.Size())
+					response.Skipped = true
+					return
+				}
+
+			case ExistingFileOverwrite:
+				state = nil
+			}
+		}
+
 		var offset int64
-		if info, err := os.Stat(request.FilePath); err == nil {
+		if info, err := os.Stat(response.FilePath); err == nil && state.canResume(request.Url) {
 			offset = info.Size()
+		} else {
+			state = &resumeState{Url: request.Url}
 		}
 
 		// Open (or create) a file for appending
-		file, err := os.OpenFile(request.FilePath, os.O_CREATE|os.O_WRONLY, 0o644)
+		file, err := os.OpenFile(response.FilePath, os.O_CREATE|os.O_WRONLY, 0o644)
 		if err != nil {
 			response.err = fmt.Errorf("could not open file: %w", err)
 			return
@@ -79,42 +190,68 @@ func (f *Fetch) DownloadFile(request *Request) *Response {
 
 		defer file.Close()
 
+		// Discard any data that can't be resumed
+		if offset == 0 {
+			if tErr := file.Truncate(0); tErr != nil {
+				response.err = fmt.Errorf("could not truncate: %w", tErr)
+				return
+			}
+		}
+
 		// Seek to the end of existing data
 		if _, fErr := file.Seek(offset, io.SeekStart); fErr != nil {
 			response.err = fmt.Errorf("could not seek: %w", fErr)
 			return
 		}
 
+		// A file with saved segments can only be resumed in segments; preallocated files can't be resumed by appending
+		if segments := f.segmentCount(request); segments > 1 && (offset == 0 || len(state.Segments) > 0) {
+			if f.downloadSegmented(response, segments, state, expected, file, ctx) {
+				return
+			}
+
+			state, offset = &resumeState{Url: request.Url}, 0
+			response.downloaded.Store(0)
+			removeResumeState(response.FilePath)
+
+			if tErr := file.Truncate(0); tErr != nil {
+				response.err = fmt.Errorf("could not truncate: %w", tErr)
+				return
+			}
+		} else if len(state.Segments) > 0 {
+			state, offset = &resumeState{Url: request.Url}, 0
+			if tErr := file.Truncate(0); tErr != nil {
+				response.err = fmt.Errorf("could not truncate: %w", tErr)
+				return
+			}
+		}
+
 		// Set up the progress callback
 		pw := &progressWriter{
 			file: file,
 			callback: func(downloaded int64) {
-				response.Downloaded += downloaded
-				if response.Size > 0 {
-					response.Progress = float64(response.Downloaded) / float64(response.Size)
-				}
+				response.addDownloaded(downloaded)
 			},
 		}
 
 		// Perform the download (with resume & retries)
-		f.downloadWithRetries(response, offset, file, pw, ctx)
+		f.downloadWithRetries(response, offset, state, expected, file, pw, mirrors, ctx)
 	}()
 
 	return response
 }
 
-// DownloadFiles downloads multiple files concurrently.
-//
-// Parameters:
-//   - requests: a slice of *Request objects representing the files to download.
-//   - parallel: the maximum number of concurrent downloads.
-//
-// Returns:
-//   - A channel of *Response objects, where each response corresponds to a file download.
-//   - A function that can be called to cancel all downloads.
-func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Response, func()) {
+// downloadAll downloads the requests concurrently, calling onStart, if not nil, when each download starts. It returns
+// the channel with the responses, a function to cancel all downloads, and a channel that is closed when all downloads
+// are complete.
+func (f *Fetch) downloadAll(
+	requests []*Request,
+	parallel int,
+	onStart func(response *Response),
+) (<-chan *Response, func(), <-chan struct{}) {
 	result := make(chan *Response)
 	done := make(chan struct{})
+	finished := make(chan struct{})
 
 	var (
 		wg      sync.WaitGroup
@@ -125,6 +262,9 @@ func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Respon
 
 	// cancelAll cancels all ongoing downloads
 	cancelAll := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
 		select {
 		case <-done:
 			// already canceled
@@ -132,8 +272,6 @@ func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Respon
 			close(done)
 		}
 
-		mu.Lock()
-		defer mu.Unlock()
 		for _, cancelFn := range cancels {
 			cancelFn()
 		}
@@ -141,6 +279,7 @@ func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Respon
 
 	go func() {
 		defer close(result)
+		defer close(finished)
 
 		for _, req := range requests {
 			wg.Add(1)
@@ -160,6 +299,9 @@ func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Respon
 
 				// Start the download
 				resp := f.DownloadFile(r)
+				if onStart != nil {
+					onStart(resp)
+				}
 
 				// Capture the Cancel() function
 				mu.Lock()
@@ -176,22 +318,83 @@ func (f *Fetch) DownloadFiles(requests []*Request, parallel int) (<-chan *Respon
 		wg.Wait()
 	}()
 
-	return result, cancelAll
+	return result, cancelAll, finished
 }
 
-// region - Private functions
+// verifyDownload checks the downloaded file against the expected size and hashes, and computes its hash. When the
+// whole file was hashed while it was downloaded, the hasher is used instead of reading the file again.
+func (f *Fetch) verifyDownload(response *Response, expected *checksum, digests []checksum, hasher *streamHasher) error {
+	algorithm, checksums := verifyChecksums(expected, digests)
+
+	expectedSize := response.Request.ExpectedSize
+	if expectedSize <= 0 {
+		expectedSize = response.size.Load()
+	}
+
+	var fileHash string
+	var err error
+	if hasher != nil {
+		fileHash, err = hasher.verify(expectedSize, checksums, algorithm)
+	} else {
+		fileHash, err = verifyFile(response.FilePath, expectedSize, checksums, algorithm)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   response.Request.Url,
+		}).Warn("downloaded file failed the integrity check")
+
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+
+	response.Hash = fileHash
+	return nil
+}
 
 func (f *Fetch) downloadWithRetries(
 	response *Response,
 	offset int64,
+	state *resumeState,
+	expected *checksum,
 	file *os.File,
 	writer io.Writer,
+	mirrors *mirrorList,
 	ctx context.Context,
 ) {
 	var resp *http.Response
 	var err error
 
-	for attempt := 0; attempt <= f.retries; attempt++ {
+	// failedOver is true when the last attempt failed and the next one uses another mirror, without waiting
+	failedOver := false
+
+	// restart discards everything that was downloaded so far, so the next attempt starts from scratch
+	restart := func() bool {
+		resp.Body.Close()
+		offset = 0
+		*state = resumeState{Url: response.Request.Url}
+		removeResumeState(response.FilePath)
+
+		if tErr := file.Truncate(0); tErr != nil {
+			response.StatusCode = resp.StatusCode
+			response.size.Store(0)
+			response.err = fmt.Errorf("truncate failed: %w", tErr)
+			return false
+		}
+
+		if _, sErr := file.Seek(0, io.SeekStart); sErr != nil {
+			response.StatusCode = resp.StatusCode
+			response.size.Store(0)
+			response.err = fmt.Errorf("seek after truncate failed: %w", sErr)
+			return false
+		}
+
+		return true
+	}
+
+	start := time.Now()
+
+	for attempt := 0; attempt < f.retryPolicy.MaxAttempts(); attempt++ {
 		// Before each attempt, see if we've been canceled
 		select {
 		case <-ctx.Done():
@@ -200,92 +403,178 @@ func (f *Fetch) downloadWithRetries(
 		default:
 		}
 
-		if attempt > 0 {
-			backoff := time.Duration(fibonacci(attempt+1)) * time.Second
+		if attempt > 0 && !failedOver {
+			backoff, limited := f.retryWait(attempt, resp)
+
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+
+			if !f.canRetry(attempt, start, backoff, statusCode, err) {
+				return
+			}
 
 			log.WithFields(log.Fields{
 				"attempt": attempt,
-				"error":   err,
+				"error":   response.err,
 				"url":     response.Request.Url,
 			}).Warn("failed to download file; retrying in ", backoff)
 
-			time.Sleep(backoff)
+			f.notifyRetry(RetryEvent{
+				Url:         response.Request.Url,
+				Attempt:     attempt,
+				StatusCode:  statusCode,
+				Err:         response.err,
+				Wait:        backoff,
+				RateLimited: limited,
+			})
+
+			if sErr := sleepContext(ctx, backoff); sErr != nil {
+				response.err = sErr
+				return
+			}
 		}
 
+		failedOver = false
+
+		// The If-Range header makes the server send the whole file again if it changed since the last attempt
 		isRangeReq := offset > 0
 		if isRangeReq {
 			response.Request.httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			response.Request.httpReq.Header.Set("If-Range", state.ifRange())
 		} else {
 			response.Request.httpReq.Header.Del("Range")
+			response.Request.httpReq.Header.Del("If-Range")
 		}
 
 		// Send it
+		attemptStart := time.Now()
 		resp, err = f.httpClient.Do(response.Request.httpReq)
 		if err != nil {
 			response.err = fmt.Errorf("request error: %w", err)
+			if ctx.Err() == nil && f.failOver(response, mirrors) {
+				failedOver = true
+				attempt--
+			}
+
 			continue
 		}
 
-		// Fallback if server doesn’t support Range
+		// Fallback if server doesn't support Range or the remote file changed
 		if isRangeReq && resp.StatusCode == http.StatusOK {
-			// Truncate file and reset offset
-			if tErr := file.Truncate(0); tErr != nil {
-				response.StatusCode = resp.StatusCode
-				response.Size = 0
-				response.err = fmt.Errorf("truncate failed: %w", tErr)
-			}
-
-			offset = 0
-
-			if _, sErr := file.Seek(0, io.SeekStart); sErr != nil {
-				response.StatusCode = resp.StatusCode
-				response.Size = 0
-				response.err = fmt.Errorf("seek after truncate failed: %w", sErr)
+			if !restart() {
+				return
 			}
 
 			attempt-- // retry same attempt count with fresh download
-			resp.Body.Close()
 			continue
 		}
 
-		response.Downloaded = offset
+		response.downloaded.Store(offset)
 
-		// Handle '416 Range Not Satisfiable' (already complete)
+		// Handle '416 Range Not Satisfiable'; it's only complete if the remote size is the same as the local file,
+		// otherwise the local file is larger than the remote one, and we must download it again
 		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			if total := parseContentRange(resp.Header.Get("Content-Range")); !isRangeReq || total != offset {
+				if !restart() {
+					return
+				}
+
+				attempt--
+				continue
+			}
+
+			response.size.Store(offset)
+			if vErr := f.verifyDownload(response, expected, nil, nil); vErr != nil {
+				if !restart() {
+					return
+				}
+
+				response.err = vErr
+				continue
+			}
+
 			response.StatusCode = resp.StatusCode
-			response.Size = offset
-			response.Progress = float64(offset) / float64(response.Size)
+			response.err = nil
 
+			removeResumeState(response.FilePath)
 			resp.Body.Close()
 			break
 		}
 
-		// If we get an error (anything that is not 2xx), then we abort this loop and go to the next attempt.
-		// We don't do that for HTTP 404 and 410, because those are cases where we know the file is not there.
-		if resp.StatusCode != 404 && resp.StatusCode != 410 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		// If we get an error (anything that is not 2xx), then we abort this loop and go to the next attempt; the retry
+		// policy decides if it's worth trying again, like for HTTP 404 and 410, where we know the file is not there.
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			response.StatusCode = resp.StatusCode
 			response.err = fmt.Errorf("unexpected status: %d", resp.StatusCode)
 			resp.Body.Close()
+
+			if resp.StatusCode >= 500 && f.failOver(response, mirrors) {
+				failedOver = true
+				attempt--
+			}
+
 			continue
 		}
 
 		// Compute total size from Content-Range or Content-Length
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+
 		if cr := resp.Header.Get("Content-Range"); cr != "" {
 			// e.g. "bytes 500-999/1234"
-			var start, end, total int64
-			if _, scanErr := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &total); scanErr == nil {
-				response.Size = total
-			} else {
-				response.Size = offset + resp.ContentLength
+			if crTotal := parseContentRange(cr); crTotal >= 0 {
+				total = crTotal
+			}
+		}
+
+		// Make sure the partial content still belongs to the same remote file
+		if isRangeReq && !state.matches(resp, total) {
+			if !restart() {
+				return
+			}
+
+			attempt--
+			continue
+		}
+
+		response.size.Store(total)
+
+		// Save the validators, so the download can be safely resumed if it's interrupted
+		state.update(resp, total)
+		if state.ifRange() != "" {
+			if sErr := state.save(response.FilePath); sErr != nil {
+				log.WithFields(log.Fields{
+					"error": sErr,
+					"url":   response.Request.Url,
+				}).Warn("failed to save resume state")
 			}
-		} else {
-			response.Size = offset + resp.ContentLength
 		}
 
 		// Track where this attempt started
 		startOffset := offset
 
+		// Server digests are only used when they describe the whole file
+		var digests []checksum
+		if resp.StatusCode == http.StatusOK {
+			digests = serverChecksums(resp)
+		}
+
+		// Files downloaded from the start are hashed while they are written; resumed ones are read again at the end
+		var hasher *streamHasher
+		dst := writer
+		if offset == 0 {
+			algorithm, checksums := verifyChecksums(expected, digests)
+			hasher = newStreamHasher(checksums, algorithm)
+			dst = io.MultiWriter(writer, hasher)
+		}
+
 		// Actually copy data
-		_, err = io.Copy(writer, resp.Body)
+		body := &throttledReader{ctx: ctx, reader: resp.Body, limiters: []*rate.Limiter{f.bandwidth, response.bandwidth}}
+		_, err = io.Copy(dst, body)
 		if err != nil {
 			if ctx.Err() != nil {
 				response.err = ctx.Err()
@@ -301,32 +590,54 @@ func (f *Fetch) downloadWithRetries(
 				break
 			}
 
-			// bump offset to resume after what we have
+			// bump offset to resume after what we have; without validators we can't resume safely
 			offset = newOffset
+			if state.ifRange() == "" {
+				offset = 0
+				if tErr := file.Truncate(0); tErr == nil {
+					_, _ = file.Seek(0, io.SeekStart)
+				}
+			}
+
 			response.err = fmt.Errorf("download interrupted (wrote %d bytes), will resume: %w",
 				newOffset-startOffset, err)
 			resp.Body.Close()
+
+			// A connection that drops in the middle of the file is resumed from another mirror, if there's one
+			if f.failOver(response, mirrors) {
+				failedOver = true
+				attempt--
+			}
+
+			continue
+		}
+
+		if response.size.Load() == -1 {
+			response.size.Store(response.downloaded.Load())
+		}
+
+		// Make sure the file is not corrupted
+		if vErr := f.verifyDownload(response, expected, digests, hasher); vErr != nil {
+			if !restart() {
+				return
+			}
+
+			response.err = vErr
 			continue
 		}
 
 		// Success
-		if response.Size == -1 {
-			response.Size = response.Downloaded
-			response.Progress = 1
+		if len(mirrors.urls) > 1 {
+			f.mirrors.record(mirrors.current(), response.downloaded.Load()-startOffset, time.Since(attemptStart))
 		}
 
 		response.StatusCode = resp.StatusCode
 		response.err = nil
+		removeResumeState(response.FilePath)
+
 		resp.Body.Close()
 		break
 	}
 }
 
-func fibonacci(n int) int {
-	if n <= 1 {
-		return n
-	}
-	return fibonacci(n-1) + fibonacci(n-2)
-}
-
 // endregion
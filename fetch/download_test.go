@@ -1,13 +1,20 @@
 package fetch
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFetch_DownloadFile(t *testing.T) {
@@ -27,7 +34,7 @@ func TestFetch_DownloadFile(t *testing.T) {
 	resp := fetch.DownloadFile(request)
 
 	assert.NoError(t, resp.Error())
-	assert.Equal(t, int64(len("file content")), resp.Size)
+	assert.Equal(t, int64(len("file content")), resp.Stats().Size)
 }
 
 func TestFetch_DownloadFile_UserAgent(t *testing.T) {
@@ -82,6 +89,466 @@ func TestFetch_DownloadFiles(t *testing.T) {
 
 	for resp := range result {
 		assert.NoError(t, resp.Error())
-		assert.Equal(t, int64(len("file content")), resp.Size)
+		assert.Equal(t, int64(len("file content")), resp.Stats().Size)
 	}
 }
+
+func TestFetch_DownloadFile_Resume(t *testing.T) {
+	const Content = "0123456789"
+	var rangeHeader string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte(Content[:4]), 0o644)
+	state := &resumeState{Url: server.URL, ETag: `"v1"`, Size: int64(len(Content))}
+	_ = state.save(filePath)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "bytes=4-", rangeHeader)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, Content, string(data))
+	assert.NoFileExists(t, resumeStatePath(filePath))
+}
+
+func TestFetch_DownloadFile_ResumeRemoteChanged(t *testing.T) {
+	const Content = "abcdefghij"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("0123"), 0o644)
+	state := &resumeState{Url: server.URL, ETag: `"v1"`, Size: int64(len(Content))}
+	_ = state.save(filePath)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_ResumeLargerThanRemote(t *testing.T) {
+	const Content = "0123456789"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte(Content+"EXTRA"), 0o644)
+	state := &resumeState{Url: server.URL, ETag: `"v1"`}
+	_ = state.save(filePath)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, int64(len(Content)), resp.Stats().Size)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_NoResumeState(t *testing.T) {
+	const Content = "0123456789"
+	var rangeHeader string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("xxxx"), 0o644)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Empty(t, rangeHeader)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_CompleteWithoutResumeState(t *testing.T) {
+	const Content = "0123456789"
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte(Content), 0o644)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	request.ExpectedHash = "sha256:84d89877f0d4041efb6bf91a16f0248f2fd573e6af05c19f96bedb9f882f7882"
+	resp := fetch.DownloadFile(request)
+
+	// The server answers the probe with 416, and the file has the expected hash, so it's not downloaded again
+	assert.NoError(t, resp.Error())
+	assert.True(t, resp.Skipped)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, int64(len(Content)), resp.Stats().Size)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_SameSizeWithoutResumeState(t *testing.T) {
+	const Content = "0123456789"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(Content))
+	}))
+
+	defer server.Close()
+
+	// A file of another URL, or an older version, with the same size
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("abcdefghij"), 0o644)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	// Without a hash, there's no way to know it's the same file, so it's downloaded again
+	assert.NoError(t, resp.Error())
+	assert.False(t, resp.Skipped)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_ExpectedHash(t *testing.T) {
+	const Content = "file content"
+	const Hash = "sha256:e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(Content))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	request.ExpectedHash = Hash
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, Hash, resp.Hash)
+}
+
+func TestFetch_DownloadFile_HashMismatch(t *testing.T) {
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("corrupted content"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 1)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	request.ExpectedHash = "sha256:e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c"
+	resp := fetch.DownloadFile(request)
+
+	assert.ErrorContains(t, resp.Error(), "integrity check failed")
+	assert.Equal(t, 2, attempts)
+}
+
+func TestFetch_DownloadFile_ServerDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// MD5 of "file content"
+		w.Header().Set("Content-MD5", "0QtMP/Ejsm3AaNQ6i+8tIw==")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("another content"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.ErrorContains(t, resp.Error(), "md5 mismatch")
+}
+
+func TestFetch_DownloadFile_ServerDigestCompressed(t *testing.T) {
+	const Content = "file content"
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(Content))
+	writer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The digest describes the compressed body, which is decompressed by the transport
+		sum := md5.Sum(compressed.Bytes())
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		w.Write(compressed.Bytes())
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, Content, string(data))
+}
+
+func TestFetch_DownloadFile_ExpectedSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	request.ExpectedSize = 100
+	resp := fetch.DownloadFile(request)
+
+	assert.ErrorContains(t, resp.Error(), "size mismatch")
+}
+
+func TestFetch_DownloadFile_ExistingFileSkip(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			requests++
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("file content"))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("file content"), 0o644)
+
+	fetch := New(nil, 0, WithExistingFilePolicy(ExistingFileSkip))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.True(t, resp.Skipped)
+	assert.Equal(t, 0, requests)
+}
+
+func TestFetch_DownloadFile_ExistingFileSkipDifferentSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("file content"))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("old"), 0o644)
+
+	fetch := New(nil, 0, WithExistingFilePolicy(ExistingFileSkip))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.False(t, resp.Skipped)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, "file content", string(data))
+}
+
+func TestFetch_DownloadFile_ExistingFileSkipUnknownSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before writing the body makes the response chunked, without a Content-Length
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		if r.Method == http.MethodGet {
+			w.Write([]byte("file content"))
+		}
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("file"), 0o644)
+
+	fetch := New(nil, 0, WithExistingFilePolicy(ExistingFileSkip))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.False(t, resp.Skipped)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, "file content", string(data))
+}
+
+func TestFetch_DownloadFile_ExistingFileOverwrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("file content"))
+	}))
+
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("file"), 0o644)
+	state := &resumeState{Url: server.URL, ETag: `"v1"`}
+	_ = state.save(filePath)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	request.ExistingFile = ExistingFileOverwrite
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, int64(len("file content")), resp.Stats().Downloaded)
+
+	data, _ := resp.Bytes()
+	assert.Equal(t, "file content", string(data))
+}
+
+func TestFetch_DownloadFile_ExistingFileRename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("existing"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "testfile (1).txt"), []byte("existing"), 0o644)
+
+	fetch := New(nil, 0, WithExistingFilePolicy(ExistingFileRename))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, filepath.Join(dir, "testfile (2).txt"), resp.FilePath)
+	assert.Equal(t, filePath, request.FilePath)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, "existing", string(data))
+}
+
+func TestFetch_DownloadFile_ExistingFileRenameConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "testfile.txt")
+	_ = os.WriteFile(filePath, []byte("existing"), 0o644)
+
+	// Every download gets its own name, even when they start at the same time
+	fetch := New(nil, 0, WithExistingFilePolicy(ExistingFileRename))
+	responses := make([]*Response, 0)
+	for i := 0; i < 10; i++ {
+		request, _ := fetch.NewRequest(server.URL, filePath)
+		responses = append(responses, fetch.DownloadFile(request))
+	}
+
+	paths := make(map[string]bool)
+	for _, resp := range responses {
+		assert.NoError(t, resp.Error())
+		paths[resp.FilePath] = true
+
+		data, _ := os.ReadFile(resp.FilePath)
+		assert.Equal(t, "file content", string(data))
+	}
+
+	assert.Len(t, paths, 10)
+	assert.NotContains(t, paths, filePath)
+}
+
+func TestFetch_DownloadFile_BandwidthLimit(t *testing.T) {
+	content := strings.Repeat("x", 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0, WithBandwidthLimit(32*1024))
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+
+	start := time.Now()
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, int64(len(content)), resp.Stats().Downloaded)
+	assert.GreaterOrEqual(t, time.Since(start), 800*time.Millisecond)
+}
+
+func TestFetch_DownloadFile_RequestBandwidthLimit(t *testing.T) {
+	content := strings.Repeat("x", 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	request.BandwidthLimit = 32 * 1024
+
+	start := time.Now()
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.GreaterOrEqual(t, time.Since(start), 800*time.Millisecond)
+}
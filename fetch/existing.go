@@ -0,0 +1,197 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExistingFilePolicy defines what happens when a file is downloaded to a path that already exists.
+type ExistingFilePolicy int
+
+const (
+	// ExistingFileDefault uses the policy set in the Fetch instance; it's only meaningful in Request.ExistingFile.
+	ExistingFileDefault ExistingFilePolicy = iota
+	// ExistingFileResume resumes the download if the existing file is a partial download of the same URL. Files without
+	// a saved state are kept when the server reports they are complete and they match Request.ExpectedHash; otherwise,
+	// including when there's no expected hash, the file is downloaded again.
+	ExistingFileResume
+	// ExistingFileSkip skips the download if the existing file has the same size (or hash, when Request.ExpectedHash
+	// is set) as the remote file; otherwise, including when the remote size is unknown, the partial download is resumed
+	// or the file is downloaded again.
+	ExistingFileSkip
+	// ExistingFileOverwrite always downloads the file again, replacing the existing one.
+	ExistingFileOverwrite
+	// ExistingFileRename saves the file with a numeric suffix, like "name (1).jpg", keeping the existing one; the new
+	// path is in Response.FilePath. Partial downloads of the same URL are still resumed.
+	ExistingFileRename
+)
+
+func (p ExistingFilePolicy) String() string {
+	switch p {
+	case ExistingFileDefault:
+		return "Default"
+	case ExistingFileResume:
+		return "Resume"
+	case ExistingFileSkip:
+		return "Skip"
+	case ExistingFileOverwrite:
+		return "Overwrite"
+	case ExistingFileRename:
+		return "Rename"
+	}
+
+	return "Unknown"
+}
+
+// UniqueFilePath returns filePath if no file exists there; otherwise it adds the first numeric suffix, like
+// "name (1).jpg", that results in a path that is not used yet. The path is not reserved, so concurrent callers can get
+// the same one.
+func UniqueFilePath(filePath string) string {
+	return uniquePath(filePath, fileExists)
+}
+
+// region - Private methods
+
+func (f *Fetch) existingFilePolicy(request *Request) ExistingFilePolicy {
+	if request.ExistingFile != ExistingFileDefault {
+		return request.ExistingFile
+	}
+
+	if f.existingFile != ExistingFileDefault {
+		return f.existingFile
+	}
+
+	return ExistingFileResume
+}
+
+// isSameFile checks if the existing file is the same as the remote one. The hash is compared when it's known,
+// otherwise the size is compared, either with the expected size or with the size reported by the server; when the size
+// is unknown, the file is not the same.
+func (f *Fetch) isSameFile(ctx context.Context, response *Response, size int64, expected *checksum) bool {
+	request := response.Request
+
+	if expected != nil {
+		fileHash, err := verifyFile(response.FilePath, request.ExpectedSize, []checksum{*expected}, expected.algorithm)
+		if err != nil {
+			return false
+		}
+
+		response.Hash = fileHash
+		return true
+	}
+
+	if request.ExpectedSize > 0 {
+		return size == request.ExpectedSize
+	}
+
+	headReq := request.httpReq.Clone(ctx)
+	headReq.Method = http.MethodHead
+	headReq.Header.Del("Range")
+	headReq.Header.Del("If-Range")
+
+	resp, err := f.httpClient.Do(headReq)
+	if err != nil {
+		return false
+	}
+
+	resp.Body.Close()
+
+	// If the server doesn't tell the size, we can't know if the existing file is complete
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.ContentLength < 0 {
+		return false
+	}
+
+	return size == resp.ContentLength
+}
+
+// isCompleteFile checks, when there's no state to resume the download, if the existing file is already complete. It
+// asks the server for the bytes after the end of the file: a '416 Range Not Satisfiable' with the same total size as the
+// file means there's nothing left to download. Without a hash to verify the file, a file with the same size could be
+// from another URL or an older version of the file, so it's never considered complete.
+func (f *Fetch) isCompleteFile(ctx context.Context, response *Response, size int64, expected *checksum) bool {
+	if size == 0 || expected == nil {
+		return false
+	}
+
+	request := response.Request
+	probeReq := request.httpReq.Clone(ctx)
+	probeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", size))
+	probeReq.Header.Del("If-Range")
+
+	resp, err := f.httpClient.Do(probeReq)
+	if err != nil {
+		return false
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable ||
+		parseContentRange(resp.Header.Get("Content-Range")) != size {
+		return false
+	}
+
+	fileHash, err := verifyFile(response.FilePath, size, []checksum{*expected}, expected.algorithm)
+	if err != nil {
+		return false
+	}
+
+	response.Hash = fileHash
+	return true
+}
+
+// endregion
+
+// region - Private functions
+
+func fileExists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+// uniquePath returns filePath if it's not in use; otherwise it adds the first numeric suffix, like "name (1).jpg",
+// that results in a path that is not used yet.
+func uniquePath(filePath string, inUse func(string) bool) string {
+	if !inUse(filePath) {
+		return filePath
+	}
+
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !inUse(candidate) {
+			return candidate
+		}
+	}
+}
+
+// reserveFilePath is like UniqueFilePath, but it creates an empty file in the path it returns, with O_EXCL, so
+// concurrent callers never get the same path.
+func reserveFilePath(filePath string) (string, error) {
+	var err error
+	reserved := uniquePath(filePath, func(p string) bool {
+		file, oErr := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(oErr, fs.ErrExist) {
+			return true
+		}
+
+		if oErr != nil {
+			err = oErr
+		} else {
+			err = file.Close()
+		}
+
+		return false
+	})
+
+	return reserved, err
+}
+
+// endregion
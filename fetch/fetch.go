@@ -1,19 +1,42 @@
 package fetch
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 type Fetch struct {
 	restClient *resty.Client
 	httpClient *http.Client
 	headers    map[string]string
-	retries    int
+
+	existingFile ExistingFilePolicy
+	bandwidth    *rate.Limiter
+	hostLimiter  *hostLimiter
+	proxies      *proxyRouter
+	cache        *httpCache
+	recorder     *Recorder
+	transport    http.RoundTripper
+	mirrors      *mirrorStats
+
+	segments         int
+	minSegmentedSize int64
+	muxer            Muxer
+	postProcessors   []PostProcessor
+
+	retryPolicy   RetryPolicy
+	maxRetryWait  time.Duration
+	retryObserver func(RetryEvent)
+
+	// restWaits keeps the wait calculated in the retry condition of each REST request until resty asks for it
+	restWaits sync.Map
 }
 
 var userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
@@ -24,7 +47,8 @@ var userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (K
 // Parameters:
 //   - headers: a map of headers to be set on each request.
 //   - retries: the number of retry attempts for failed requests.
-func New(headers map[string]string, retries int) *Fetch {
+//   - options: optional settings, like WithExistingFilePolicy.
+func New(headers map[string]string, retries int, options ...Option) *Fetch {
 	logger := log.New()
 
 	f := resty.New()
@@ -38,36 +62,99 @@ func New(headers map[string]string, retries int) *Fetch {
 		headers["User-Agent"] = userAgent
 	}
 
-	return &Fetch{
-		restClient: f.
-			SetLogger(logger).
-			SetHeaders(headers).
-			SetRetryCount(retries).
-			SetRetryWaitTime(0).
-			AddRetryCondition(
-				func(r *resty.Response, err error) bool {
-					if (err != nil || r.IsError()) && r.Request.Attempt <= retries {
-						sleep := time.Duration(fibonacci(r.Request.Attempt+1)) * time.Second
-
-						log.WithFields(log.Fields{
-							"attempt": r.Request.Attempt,
-							"error":   r.Error(),
-							"status":  r.StatusCode(),
-							"url":     r.Request.URL,
-						}).Warn("failed to get data; retrying in ", sleep)
-
-						time.Sleep(sleep)
-						return true
-					}
+	// The host limits and the proxies are shared by the REST client and the downloads
+	limiter := newHostLimiter(DefaultHostLimits)
+	proxies := newProxyRouter()
+
+	if transport, ok := f.GetClient().Transport.(*http.Transport); ok {
+		transport.Proxy = proxies.proxy
+	}
+
+	httpClient := newIdleTimeoutClient(30*time.Second, proxies.proxy)
+
+	fetch := &Fetch{
+		httpClient:   httpClient,
+		headers:      headers,
+		retryPolicy:  NewDefaultRetryPolicy(retries),
+		bandwidth:    newBandwidthLimiter(0),
+		hostLimiter:  limiter,
+		proxies:      proxies,
+		mirrors:      newMirrorStats(),
+		maxRetryWait: defaultMaxRetryWait,
+
+		minSegmentedSize: defaultMinSegmentedSize,
+	}
+
+	// A Recorder, when set, answers the requests before they count against the host limits
+	restLimits := &hostLimitTransport{base: f.GetClient().Transport, limiter: limiter}
+	f.SetTransport(&recorderTransport{base: restLimits, fetch: fetch})
 
+	httpLimits := &hostLimitTransport{base: httpClient.Transport, limiter: limiter}
+	httpClient.Transport = &recorderTransport{base: httpLimits, fetch: fetch}
+
+	// The retry condition only decides if the request must be retried; the wait is calculated in SetRetryAfter, so
+	// resty can stop waiting when the request's context is canceled
+	fetch.restClient = f.
+		SetLogger(logger).
+		SetHeaders(headers).
+		SetRetryWaitTime(0).
+		SetRetryMaxWaitTime(24 * time.Hour).
+		AddRetryCondition(
+			func(r *resty.Response, err error) bool {
+				if err == nil && !r.IsError() {
 					return false
-				},
-			),
+				}
+
+				sleep, limited := fetch.retryWait(r.Request.Attempt, r.RawResponse)
+				start, _ := r.Request.Context().Value(retryStartKey{}).(time.Time)
+
+				if fetch.canRetry(r.Request.Attempt, start, sleep, r.StatusCode(), err) {
+					fetch.restWaits.Store(r.Request, sleep)
+
+					log.WithFields(log.Fields{
+						"attempt": r.Request.Attempt,
+						"error":   r.Error(),
+						"status":  r.StatusCode(),
+						"url":     r.Request.URL,
+					}).Warn("failed to get data; retrying in ", sleep)
 
-		httpClient: newIdleTimeoutClient(30 * time.Second),
-		headers:    headers,
-		retries:    retries,
+					fetch.notifyRetry(RetryEvent{
+						Url:         r.Request.URL,
+						Attempt:     r.Request.Attempt,
+						StatusCode:  r.StatusCode(),
+						Err:         err,
+						Wait:        sleep,
+						RateLimited: limited,
+					})
+
+					return true
+				}
+
+				return false
+			},
+		).
+		SetRetryAfter(func(_ *resty.Client, r *resty.Response) (time.Duration, error) {
+			sleep, exists := fetch.restWaits.LoadAndDelete(r.Request)
+			if !exists {
+				sleep, _ = fetch.retryWait(r.Request.Attempt, r.RawResponse)
+			}
+
+			return max(sleep.(time.Duration), time.Nanosecond), nil
+		})
+
+	for _, option := range options {
+		option(fetch)
 	}
+
+	// The transport set with WithTransport replaces the network, but still goes through the host limits
+	if fetch.transport != nil {
+		restLimits.base = fetch.transport
+		httpLimits.base = fetch.transport
+	}
+
+	fetch.restClient.SetRetryCount(fetch.retryPolicy.MaxAttempts() - 1)
+
+	return fetch
 }
 
 // GetText performs a GET request to the specified URL and returns the response body as a string.
@@ -77,7 +164,19 @@ func New(headers map[string]string, retries int) *Fetch {
 //
 // Returns the response body as a string and an error if the request fails.
 func (f *Fetch) GetText(url string) (string, error) {
+	return f.GetTextContext(context.Background(), url)
+}
+
+// GetTextContext is like GetText, but the request, and any wait before a retry, stops when the context is canceled.
+//
+// Parameters:
+//   - ctx: the context of the request.
+//   - url: the URL to send the GET request to.
+//
+// Returns the response body as a string and an error if the request fails.
+func (f *Fetch) GetTextContext(ctx context.Context, url string) (string, error) {
 	resp, err := f.restClient.R().
+		SetContext(withRetryStart(ctx)).
 		Get(url)
 
 	if err != nil {
@@ -114,7 +213,29 @@ func (f *Fetch) GetText(url string) (string, error) {
 //   - *resty.Response: the response from the GET request.
 //   - error: an error if the request fails or the response indicates an error.
 func (f *Fetch) GetResult(url string, headers map[string]string, result interface{}) (*resty.Response, error) {
+	return f.GetResultContext(context.Background(), url, headers, result)
+}
+
+// GetResultContext is like GetResult, but the request, and any wait before a retry, stops when the context is
+// canceled.
+//
+// Parameters:
+//   - ctx: the context of the request.
+//   - url: the URL to send the GET request to.
+//   - headers: extra headers sent with the request.
+//   - result: a pointer to the variable where the response body will be unmarshalled.
+//
+// Returns:
+//   - *resty.Response: the response from the GET request.
+//   - error: an error if the request fails or the response indicates an error.
+func (f *Fetch) GetResultContext(
+	ctx context.Context,
+	url string,
+	headers map[string]string,
+	result interface{},
+) (*resty.Response, error) {
 	resp, err := f.restClient.R().
+		SetContext(withRetryStart(ctx)).
 		SetHeaders(headers).
 		ForceContentType("application/json").
 		SetResult(result).
@@ -0,0 +1,268 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// hlsVariant is a variant in an HLS master playlist.
+type hlsVariant struct {
+	uri        string
+	bandwidth  int64
+	audioGroup string
+}
+
+// hlsRendition is an alternative audio track in an HLS master playlist.
+type hlsRendition struct {
+	uri       string
+	group     string
+	isDefault bool
+}
+
+// region - Private functions
+
+// hlsTracks returns the video and audio tracks with the highest quality in the HLS playlist. Media playlists, which
+// have no variants, are returned as a video track.
+func (f *Fetch) hlsTracks(ctx context.Context, playlistUrl string, playlist string) (*streamTrack, *streamTrack, error) {
+	base, err := url.Parse(playlistUrl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid playlist URL '%s': %w", playlistUrl, err)
+	}
+
+	if !strings.Contains(playlist, "#EXT-X-STREAM-INF") {
+		video, pErr := parseHlsMedia(base, playlist)
+		return video, nil, pErr
+	}
+
+	variants, renditions, err := parseHlsMaster(base, playlist)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	best := variants[0]
+	for _, variant := range variants[1:] {
+		if variant.bandwidth > best.bandwidth {
+			best = variant
+		}
+	}
+
+	video, err := f.hlsMediaTrack(ctx, best.uri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	video.bandwidth = best.bandwidth
+
+	// The default audio of the variant's group is preferred
+	var audioUri string
+	for _, rendition := range renditions {
+		if rendition.group == best.audioGroup && rendition.uri != "" && (audioUri == "" || rendition.isDefault) {
+			audioUri = rendition.uri
+		}
+	}
+
+	if best.audioGroup == "" || audioUri == "" {
+		return video, nil, nil
+	}
+
+	audio, err := f.hlsMediaTrack(ctx, audioUri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return video, audio, nil
+}
+
+// hlsMediaTrack downloads and parses a media playlist.
+func (f *Fetch) hlsMediaTrack(ctx context.Context, playlistUrl string) (*streamTrack, error) {
+	playlist, err := f.GetTextContext(ctx, playlistUrl)
+	if err != nil {
+		return nil, fmt.Errorf("could not get media playlist: %w", err)
+	}
+
+	base, err := url.Parse(playlistUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL '%s': %w", playlistUrl, err)
+	}
+
+	return parseHlsMedia(base, playlist)
+}
+
+// parseHlsMaster parses the variants and the audio renditions of a master playlist.
+func parseHlsMaster(base *url.URL, playlist string) ([]hlsVariant, []hlsRendition, error) {
+	variants := make([]hlsVariant, 0)
+	renditions := make([]hlsRendition, 0)
+
+	var pending *hlsVariant
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attributes := parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bandwidth, _ := strconv.ParseInt(attributes["BANDWIDTH"], 10, 64)
+			pending = &hlsVariant{bandwidth: bandwidth, audioGroup: attributes["AUDIO"]}
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attributes := parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attributes["TYPE"] != "AUDIO" {
+				continue
+			}
+
+			rendition := hlsRendition{group: attributes["GROUP-ID"], isDefault: attributes["DEFAULT"] == "YES"}
+			if uri := attributes["URI"]; uri != "" {
+				resolved, err := resolveUrl(base, uri)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				rendition.uri = resolved
+			}
+
+			renditions = append(renditions, rendition)
+
+		case line != "" && !strings.HasPrefix(line, "#") && pending != nil:
+			resolved, err := resolveUrl(base, line)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			pending.uri = resolved
+			variants = append(variants, *pending)
+			pending = nil
+		}
+	}
+
+	if len(variants) == 0 {
+		return nil, nil, fmt.Errorf("no variants found in the HLS playlist")
+	}
+
+	return variants, renditions, nil
+}
+
+// parseHlsMedia parses the segments of a media playlist, including the initialization segment and byte ranges.
+func parseHlsMedia(base *url.URL, playlist string) (*streamTrack, error) {
+	track := &streamTrack{segments: make([]streamSegment, 0)}
+
+	// The offset of a byte range is optional; it continues from the end of the previous range of the same file
+	nextOffset := make(map[string]int64)
+	var pendingRange *streamSegment
+
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attributes := parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			if method := attributes["METHOD"]; method != "" && method != "NONE" {
+				return nil, fmt.Errorf("encrypted HLS streams are not supported (%s)", method)
+			}
+
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			attributes := parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))
+			resolved, err := resolveUrl(base, attributes["URI"])
+			if err != nil {
+				return nil, err
+			}
+
+			init := streamSegment{url: resolved, length: -1}
+			if byteRange := attributes["BYTERANGE"]; byteRange != "" {
+				if init.length, init.offset, err = parseHlsByteRange(byteRange, 0); err != nil {
+					return nil, err
+				}
+			}
+
+			track.init = &init
+
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			length, offset, err := parseHlsByteRange(strings.TrimPrefix(line, "#EXT-X-BYTERANGE:"), -1)
+			if err != nil {
+				return nil, err
+			}
+
+			pendingRange = &streamSegment{offset: offset, length: length}
+
+		case line != "" && !strings.HasPrefix(line, "#"):
+			resolved, err := resolveUrl(base, line)
+			if err != nil {
+				return nil, err
+			}
+
+			segment := streamSegment{url: resolved, length: -1}
+			if pendingRange != nil {
+				segment.length = pendingRange.length
+				segment.offset = pendingRange.offset
+				if segment.offset < 0 {
+					segment.offset = nextOffset[resolved]
+				}
+
+				nextOffset[resolved] = segment.offset + segment.length
+				pendingRange = nil
+			}
+
+			track.segments = append(track.segments, segment)
+		}
+	}
+
+	if len(track.segments) == 0 {
+		return nil, fmt.Errorf("no segments found in the HLS playlist")
+	}
+
+	return track, nil
+}
+
+// parseHlsByteRange parses a byte range in the format "<length>[@<offset>]".
+func parseHlsByteRange(value string, defaultOffset int64) (int64, int64, error) {
+	lengthStr, offsetStr, hasOffset := strings.Cut(strings.Trim(value, `"`), "@")
+
+	length, err := strconv.ParseInt(lengthStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid byte range '%s': %w", value, err)
+	}
+
+	offset := defaultOffset
+	if hasOffset {
+		if offset, err = strconv.ParseInt(offsetStr, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid byte range '%s': %w", value, err)
+		}
+	}
+
+	return length, offset, nil
+}
+
+// parseHlsAttributes parses an attribute list, like `BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"`, where quoted
+// values can have commas.
+func parseHlsAttributes(list string) map[string]string {
+	attributes := make(map[string]string)
+
+	for len(list) > 0 {
+		key, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attributes[strings.TrimSpace(key)] = value
+		list = rest
+	}
+
+	return attributes
+}
+
+// endregion
@@ -0,0 +1,182 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// HostLimit defines how fast and how many requests can be sent at the same time to a host.
+type HostLimit struct {
+	// RequestsPerSecond is the maximum number of requests started per second; zero means no limit.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests that can be started at once, before RequestsPerSecond is enforced. Values
+	// smaller than 1 are treated as 1.
+	Burst int
+
+	// MaxConnections is the maximum number of requests in progress at the same time; a download is in progress until
+	// its body is closed. Zero means no limit.
+	MaxConnections int
+}
+
+// DefaultHostLimits are the limits applied to every new Fetch instance; they are tuned to avoid being throttled or
+// banned by the supported sites. A host also matches all its subdomains, so "reddit.com" applies to "www.reddit.com".
+var DefaultHostLimits = map[string]HostLimit{
+	"reddit.com":  {RequestsPerSecond: 1, Burst: 5, MaxConnections: 4},
+	"redd.it":     {RequestsPerSecond: 5, Burst: 10, MaxConnections: 8},
+	"coomer.st":   {RequestsPerSecond: 2, Burst: 4, MaxConnections: 4},
+	"kemono.cr":   {RequestsPerSecond: 2, Burst: 4, MaxConnections: 4},
+	"redgifs.com": {RequestsPerSecond: 5, Burst: 10, MaxConnections: 8},
+	"fapello.com": {RequestsPerSecond: 4, Burst: 8, MaxConnections: 4},
+	"imaglr.com":  {RequestsPerSecond: 4, Burst: 8, MaxConnections: 4},
+}
+
+// SetHostLimit changes, at runtime, the limits of a host and its subdomains. Use a zero HostLimit to remove the limits.
+//
+// # Parameters:
+//   - host: the host name, like "reddit.com".
+//   - limit: the limits applied to the host.
+func (f *Fetch) SetHostLimit(host string, limit HostLimit) {
+	f.hostLimiter.setRule(host, limit)
+}
+
+// region - Private functions
+
+type hostLimiter struct {
+	mu    sync.Mutex
+	rules map[string]HostLimit
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	rate  *rate.Limiter
+	slots chan struct{}
+}
+
+func newHostLimiter(rules map[string]HostLimit) *hostLimiter {
+	limiter := &hostLimiter{
+		rules: make(map[string]HostLimit),
+		hosts: make(map[string]*hostState),
+	}
+
+	for host, limit := range rules {
+		limiter.rules[strings.ToLower(host)] = limit
+	}
+
+	return limiter
+}
+
+func (h *hostLimiter) setRule(host string, limit HostLimit) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	host = strings.ToLower(host)
+	h.rules[host] = limit
+
+	// Hosts affected by the rule will have their state recreated in the next request
+	for name := range h.hosts {
+		if matchesHost(name, host) {
+			delete(h.hosts, name)
+		}
+	}
+}
+
+// state returns the state of the host, created from the most specific rule that matches it.
+func (h *hostLimiter) state(host string) *hostState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	host = strings.ToLower(host)
+	if state, exists := h.hosts[host]; exists {
+		return state
+	}
+
+	var limit HostLimit
+	matched := ""
+	for rule, ruleLimit := range h.rules {
+		if matchesHost(host, rule) && len(rule) > len(matched) {
+			matched = rule
+			limit = ruleLimit
+		}
+	}
+
+	state := &hostState{rate: rate.NewLimiter(rate.Inf, 1)}
+	if limit.RequestsPerSecond > 0 {
+		state.rate = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), max(limit.Burst, 1))
+	}
+
+	if limit.MaxConnections > 0 {
+		state.slots = make(chan struct{}, limit.MaxConnections)
+	}
+
+	h.hosts[host] = state
+	return state
+}
+
+// acquire waits until a request can be sent to the host. The returned function must be called when the request is
+// complete, to free its connection slot.
+func (h *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	state := h.state(host)
+	release := func() {}
+
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+			release = sync.OnceFunc(func() { <-state.slots })
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := state.rate.Wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// hostLimitTransport is a http.RoundTripper that enforces the host limits before sending each request.
+type hostLimitTransport struct {
+	base    http.RoundTripper
+	limiter *hostLimiter
+}
+
+func (t *hostLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseBody frees the connection slot of the host when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+func matchesHost(host string, rule string) bool {
+	return host == rule || strings.HasSuffix(host, "."+rule)
+}
+
+// endregion
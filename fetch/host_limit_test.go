@@ -0,0 +1,81 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch_HostLimit_RequestsPerSecond(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Hello, World!"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0, WithHostLimit("127.0.0.1", HostLimit{RequestsPerSecond: 5, Burst: 1}))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		_, err := fetch.GetText(server.URL)
+		assert.NoError(t, err)
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 550*time.Millisecond)
+}
+
+func TestFetch_HostLimit_MaxConnections(t *testing.T) {
+	var current, peak int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0, WithHostLimit("127.0.0.1", HostLimit{MaxConnections: 2}))
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = fetch.GetText(server.URL)
+		}()
+	}
+
+	requests := lo.Map([]int{1, 2, 3}, func(i int, _ int) *Request {
+		r, _ := fetch.NewRequest(server.URL, filepath.Join(dir, fmt.Sprintf("testfile%d.txt", i)))
+		return r
+	})
+
+	result, _ := fetch.DownloadFiles(requests, 3)
+	for resp := range result {
+		assert.NoError(t, resp.Error())
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -24,9 +25,10 @@ func (c *timeoutConn) Write(b []byte) (int, error) {
 	return c.Conn.Write(b)
 }
 
-func newIdleTimeoutClient(idleTimeout time.Duration) *http.Client {
+func newIdleTimeoutClient(idleTimeout time.Duration, proxy func(*http.Request) (*url.URL, error)) *http.Client {
 	// clone the default Transport (to inherit all defaults)
 	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = proxy
 
 	// wrap DialContext to install our timeoutConn
 	base.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -0,0 +1,204 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultHashAlgorithm is the algorithm used to compute Response.Hash when the request doesn't expect any hash.
+const defaultHashAlgorithm = "sha256"
+
+// checksum is a digest of a file, computed with a specific algorithm.
+type checksum struct {
+	algorithm string
+	value     []byte
+	source    string
+}
+
+// parseHash parses a hash in the format "<algorithm>:<hex value>", like "sha256:e3b0c442...".
+func parseHash(value string) (*checksum, error) {
+	algorithm, hexValue, found := strings.Cut(value, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid hash '%s': expected format <algorithm>:<hex>", value)
+	}
+
+	algorithm = strings.ToLower(algorithm)
+	if newHash(algorithm) == nil {
+		return nil, fmt.Errorf("unsupported hash algorithm '%s'", algorithm)
+	}
+
+	decoded, err := hex.DecodeString(hexValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash '%s': %w", value, err)
+	}
+
+	return &checksum{algorithm: algorithm, value: decoded, source: "request"}, nil
+}
+
+// serverChecksums collects the digests that the server sent along with the file, in the headers Digest, Repr-Digest,
+// Content-MD5 and x-amz-checksum-*. Unsupported algorithms are ignored, and there are no digests when the body was
+// transparently decompressed.
+func serverChecksums(resp *http.Response) []checksum {
+	checksums := make([]checksum, 0)
+
+	// The digests describe the compressed body, not the file that was saved
+	if resp.Uncompressed {
+		return checksums
+	}
+
+	add := func(algorithm string, encoded string, source string) {
+		algorithm = normalizeAlgorithm(algorithm)
+		if newHash(algorithm) == nil {
+			return
+		}
+
+		value, err := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimSpace(encoded), ":"))
+		if err != nil {
+			return
+		}
+
+		checksums = append(checksums, checksum{algorithm: algorithm, value: value, source: source})
+	}
+
+	// e.g. "sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=, md5=..."
+	for _, header := range []string{"Digest", "Repr-Digest"} {
+		for _, part := range strings.Split(resp.Header.Get(header), ",") {
+			if algorithm, encoded, found := strings.Cut(strings.TrimSpace(part), "="); found {
+				add(algorithm, encoded, header)
+			}
+		}
+	}
+
+	if value := resp.Header.Get("Content-MD5"); value != "" {
+		add("md5", value, "Content-MD5")
+	}
+
+	for _, algorithm := range []string{"sha1", "sha256"} {
+		header := "X-Amz-Checksum-" + algorithm
+		if value := resp.Header.Get(header); value != "" {
+			add(algorithm, value, header)
+		}
+	}
+
+	return checksums
+}
+
+// verifyFile checks if the file has the expected size and checksums. It returns the hash of the file, computed with the
+// given algorithm, in the format "<algorithm>:<hex value>".
+func verifyFile(filePath string, expectedSize int64, checksums []checksum, algorithm string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not open file for verification: %w", err)
+	}
+
+	defer file.Close()
+
+	// Compute all the hashes we need with a single read of the file
+	hasher := newStreamHasher(checksums, algorithm)
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("could not read file for verification: %w", err)
+	}
+
+	return hasher.verify(expectedSize, checksums, algorithm)
+}
+
+// streamHasher computes the hashes of a file while it's written, so a download can be verified without reading the
+// whole file again.
+type streamHasher struct {
+	hashes map[string]hash.Hash
+	size   int64
+}
+
+// newStreamHasher creates a streamHasher that computes the hash with the given algorithm and the hashes needed to check
+// the checksums.
+func newStreamHasher(checksums []checksum, algorithm string) *streamHasher {
+	hashes := map[string]hash.Hash{algorithm: newHash(algorithm)}
+	for _, c := range checksums {
+		if _, exists := hashes[c.algorithm]; !exists {
+			hashes[c.algorithm] = newHash(c.algorithm)
+		}
+	}
+
+	return &streamHasher{hashes: hashes}
+}
+
+func (s *streamHasher) Write(p []byte) (int, error) {
+	for _, h := range s.hashes {
+		h.Write(p)
+	}
+
+	s.size += int64(len(p))
+	return len(p), nil
+}
+
+// verify checks the data written so far against the expected size and checksums. It returns the hash computed with the
+// given algorithm, in the format "<algorithm>:<hex value>".
+func (s *streamHasher) verify(expectedSize int64, checksums []checksum, algorithm string) (string, error) {
+	if expectedSize > 0 && s.size != expectedSize {
+		return "", fmt.Errorf("size mismatch: expected %d bytes, got %d", expectedSize, s.size)
+	}
+
+	for _, c := range checksums {
+		if actual := s.hashes[c.algorithm].Sum(nil); !bytes.Equal(actual, c.value) {
+			return "", fmt.Errorf("%s mismatch (%s): expected %x, got %x", c.algorithm, c.source, c.value, actual)
+		}
+	}
+
+	return algorithm + ":" + hex.EncodeToString(s.hashes[algorithm].Sum(nil)), nil
+}
+
+// region - Private functions
+
+// verifyChecksums returns the algorithm of the file hash, the expected one or the default, and all the checksums that
+// the file must match.
+func verifyChecksums(expected *checksum, digests []checksum) (string, []checksum) {
+	if expected == nil {
+		return defaultHashAlgorithm, digests
+	}
+
+	return expected.algorithm, append(slices.Clone(digests), *expected)
+}
+
+func normalizeAlgorithm(algorithm string) string {
+	switch strings.ToLower(strings.TrimSpace(algorithm)) {
+	case "md5":
+		return "md5"
+	case "sha", "sha1", "sha-1":
+		return "sha1"
+	case "sha256", "sha-256":
+		return "sha256"
+	case "sha512", "sha-512":
+		return "sha512"
+	default:
+		return ""
+	}
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// endregion
@@ -0,0 +1,338 @@
+package fetch
+
+import (
+	"fmt"
+	"sync"
+)
+
+// downloadState is the state of a download in a Manager.
+type downloadState int
+
+const (
+	statePending downloadState = iota
+	stateActive
+	statePaused
+	stateDone
+)
+
+// managedDownload is a request added to a Manager.
+type managedDownload struct {
+	request  *Request
+	priority int
+	seq      int
+	state    downloadState
+	response *Response
+
+	// pausing is true when an active download was canceled to be paused, not stopped for good
+	pausing bool
+	// resuming is true when a download is resumed before it stopped being paused
+	resuming bool
+}
+
+// Manager downloads a batch of requests concurrently, like Fetch.DownloadFiles, but the batch can be changed while it
+// runs: requests can be added, paused, resumed and reprioritised, and the number of parallel downloads can be changed.
+//
+// Paused downloads keep their partial data, and continue from where they stopped when resumed, as long as the server
+// sends the validators needed to resume them safely.
+type Manager struct {
+	fetch *Fetch
+
+	mu        sync.Mutex
+	changed   *sync.Cond
+	parallel  int
+	active    int
+	seq       int
+	downloads map[*Request]*managedDownload
+	outbox    []*Response
+	closed    bool
+
+	results chan *Response
+}
+
+// NewManager creates a Manager that downloads up to parallel requests at the same time.
+//
+// # Parameters:
+//   - parallel: the maximum number of concurrent downloads.
+func (f *Fetch) NewManager(parallel int) *Manager {
+	m := &Manager{
+		fetch:     f,
+		parallel:  max(parallel, 1),
+		downloads: make(map[*Request]*managedDownload),
+		outbox:    make([]*Response, 0),
+		results:   make(chan *Response),
+	}
+
+	m.changed = sync.NewCond(&m.mu)
+	go m.dispatch()
+
+	return m
+}
+
+// Results returns a channel with the Response of each download once it's complete, successfully or not. Paused
+// downloads are not complete. The channel is closed after Close is called and all downloads are complete.
+func (m *Manager) Results() <-chan *Response {
+	return m.results
+}
+
+// Add adds requests to the batch. Requests with higher priority are downloaded first; requests with the same priority
+// are downloaded in the order they were added.
+//
+// # Parameters:
+//   - priority: the priority of the requests.
+//   - requests: the requests to be downloaded.
+//
+// # Returns:
+//   - An error if the manager is closed.
+func (m *Manager) Add(priority int, requests ...*Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("download manager is closed")
+	}
+
+	for _, request := range requests {
+		if _, exists := m.downloads[request]; exists {
+			continue
+		}
+
+		m.seq++
+		m.downloads[request] = &managedDownload{request: request, priority: priority, seq: m.seq}
+	}
+
+	m.schedule()
+	return nil
+}
+
+// Response returns the Response of the current transfer of the request, which can be used to track its progress. It
+// returns nil if the request was never started. Pausing and resuming a download creates a new Response.
+func (m *Manager) Response(request *Request) *Response {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d, exists := m.downloads[request]; exists {
+		return d.response
+	}
+
+	return nil
+}
+
+// Pause pauses the download of the request, keeping the data downloaded so far. Pending requests are not started
+// until they are resumed.
+//
+// # Returns:
+//   - An error if the request is not in the manager.
+func (m *Manager) Pause(request *Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, exists := m.downloads[request]
+	if !exists {
+		return fmt.Errorf("request '%s' not found in the download manager", request.Url)
+	}
+
+	m.pause(d)
+	return nil
+}
+
+// Resume resumes the download of a paused request; it goes back to the batch with the same priority.
+//
+// # Returns:
+//   - An error if the request is not in the manager.
+func (m *Manager) Resume(request *Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, exists := m.downloads[request]
+	if !exists {
+		return fmt.Errorf("request '%s' not found in the download manager", request.Url)
+	}
+
+	m.resume(d)
+	m.schedule()
+	return nil
+}
+
+// PauseAll pauses all the downloads that are not complete.
+func (m *Manager) PauseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.downloads {
+		m.pause(d)
+	}
+}
+
+// ResumeAll resumes all the paused downloads.
+func (m *Manager) ResumeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.downloads {
+		m.resume(d)
+	}
+
+	m.schedule()
+}
+
+// SetPriority changes the priority of a request that was not started yet.
+//
+// # Returns:
+//   - An error if the request is not in the manager.
+func (m *Manager) SetPriority(request *Request, priority int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, exists := m.downloads[request]
+	if !exists {
+		return fmt.Errorf("request '%s' not found in the download manager", request.Url)
+	}
+
+	d.priority = priority
+	return nil
+}
+
+// SetParallel changes the maximum number of concurrent downloads. When it's reduced, the downloads in progress are not
+// interrupted; new downloads only start once the number of active downloads is below the new limit.
+func (m *Manager) SetParallel(parallel int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parallel = max(parallel, 1)
+	m.schedule()
+}
+
+// Close tells the manager that no more requests will be added; the channel returned by Results is closed once all
+// downloads are complete. Paused downloads must be resumed for the channel to be closed.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.changed.Broadcast()
+}
+
+// region - Private functions
+
+// pause pauses the download; the caller must hold the lock.
+func (m *Manager) pause(d *managedDownload) {
+	switch d.state {
+	case statePending:
+		d.state = statePaused
+	case stateActive:
+		d.resuming = false
+		if !d.pausing {
+			d.pausing = true
+			d.response.pause()
+		}
+	}
+}
+
+// resume resumes the download; the caller must hold the lock.
+func (m *Manager) resume(d *managedDownload) {
+	if d.state == statePaused {
+		d.state = statePending
+	}
+
+	// The download is still stopping, so it's started again once it stops
+	if d.pausing {
+		d.resuming = true
+	}
+}
+
+// schedule starts the pending downloads with the highest priority, while there are free slots; the caller must hold
+// the lock.
+func (m *Manager) schedule() {
+	for m.active < m.parallel {
+		var next *managedDownload
+		for _, d := range m.downloads {
+			if d.state != statePending {
+				continue
+			}
+
+			if next == nil || d.priority > next.priority || (d.priority == next.priority && d.seq < next.seq) {
+				next = d
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		m.start(next)
+	}
+
+	m.changed.Broadcast()
+}
+
+// start downloads the request; the caller must hold the lock.
+func (m *Manager) start(d *managedDownload) {
+	// A paused download is always resumed, regardless of the existing file policy
+	policy := m.fetch.existingFilePolicy(d.request)
+	if d.response != nil && policy == ExistingFileOverwrite {
+		policy = ExistingFileResume
+	}
+
+	d.state = stateActive
+	d.response = m.fetch.downloadFile(d.request, policy)
+	m.active++
+
+	go func(response *Response) {
+		err := response.Error()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.active--
+
+		switch {
+		case d.pausing && err != nil && d.resuming:
+			d.state = statePending
+		case d.pausing && err != nil:
+			d.state = statePaused
+		default:
+			d.state = stateDone
+			m.outbox = append(m.outbox, response)
+		}
+
+		d.pausing, d.resuming = false, false
+		m.schedule()
+	}(d.response)
+}
+
+// dispatch sends the complete downloads to the results channel, without holding the lock, so a slow consumer doesn't
+// block the manager; it closes the channel once the manager is closed and there's nothing left to download.
+func (m *Manager) dispatch() {
+	defer close(m.results)
+
+	for {
+		m.mu.Lock()
+		for len(m.outbox) == 0 && !(m.closed && m.finished()) {
+			m.changed.Wait()
+		}
+
+		if len(m.outbox) == 0 {
+			m.mu.Unlock()
+			return
+		}
+
+		response := m.outbox[0]
+		m.outbox = m.outbox[1:]
+		m.mu.Unlock()
+
+		m.results <- response
+	}
+}
+
+// finished checks if all downloads are complete; the caller must hold the lock.
+func (m *Manager) finished() bool {
+	for _, d := range m.downloads {
+		if d.state != stateDone {
+			return false
+		}
+	}
+
+	return true
+}
+
+// endregion
@@ -0,0 +1,177 @@
+package fetch
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_PauseResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10_000))
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	ranges := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0, WithBandwidthLimit(200_000), WithExistingFilePolicy(ExistingFileOverwrite))
+	manager := fetch.NewManager(1)
+
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	assert.NoError(t, manager.Add(0, request))
+
+	// Pause once part of the file was downloaded
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(filePath)
+		return err == nil && info.Size() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, manager.Pause(request))
+	assert.Error(t, manager.Response(request).Error())
+
+	// A paused download is not reported as canceled
+	stats := manager.Response(request).Stats()
+	assert.True(t, stats.Paused)
+	assert.False(t, stats.Canceled)
+
+	fetch.SetBandwidthLimit(0)
+	assert.NoError(t, manager.Resume(request))
+	manager.Close()
+
+	results := make([]*Response, 0)
+	for resp := range manager.Results() {
+		results = append(results, resp)
+	}
+
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Error())
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, content, data)
+
+	assert.Len(t, ranges, 2)
+	assert.Equal(t, "", ranges[0])
+	assert.True(t, strings.HasPrefix(ranges[1], "bytes="))
+
+	// The download is resumed even with the Overwrite policy, without changing the request
+	assert.Equal(t, ExistingFileDefault, request.ExistingFile)
+}
+
+func TestManager_Priority(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	order := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+
+		if r.URL.Path == "/first" {
+			<-release
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0)
+	manager := fetch.NewManager(1)
+
+	newRequest := func(name string) *Request {
+		request, _ := fetch.NewRequest(server.URL+"/"+name, filepath.Join(dir, name))
+		return request
+	}
+
+	first := newRequest("first")
+	low := newRequest("low")
+	high := newRequest("high")
+	later := newRequest("later")
+
+	manager.Add(0, first)
+	manager.Add(0, low)
+	manager.Add(5, high)
+	manager.Add(1, later)
+	manager.SetPriority(low, 10)
+
+	close(release)
+	manager.Close()
+
+	count := 0
+	for resp := range manager.Results() {
+		assert.NoError(t, resp.Error())
+		count++
+	}
+
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []string{"/first", "/low", "/high", "/later"}, order)
+}
+
+func TestManager_SetParallel(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	started := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0)
+	manager := fetch.NewManager(1)
+
+	for _, name := range []string{"a", "b", "c"} {
+		request, _ := fetch.NewRequest(server.URL+"/"+name, filepath.Join(dir, name))
+		manager.Add(0, request)
+	}
+
+	startedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return started
+	}
+
+	assert.Eventually(t, func() bool { return startedCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool { return startedCount() > 1 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	manager.SetParallel(3)
+	assert.Eventually(t, func() bool { return startedCount() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	close(release)
+	manager.Close()
+
+	count := 0
+	for range manager.Results() {
+		count++
+	}
+
+	assert.Equal(t, 3, count)
+}
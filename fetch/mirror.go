@@ -0,0 +1,201 @@
+package fetch
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// mirrorFailurePenalty is for how long a host that failed is tried after the other mirrors.
+const mirrorFailurePenalty = 5 * time.Minute
+
+// mirrorSpeedSmoothing is the weight of the last measured speed in the average speed of a host.
+const mirrorSpeedSmoothing = 0.5
+
+// mirrorStats keeps the download speed measured in each host, and when it last failed, to choose the best mirror of a
+// file. It's shared by all downloads of a Fetch instance.
+type mirrorStats struct {
+	mu     sync.Mutex
+	speeds map[string]float64
+	failed map[string]time.Time
+}
+
+func newMirrorStats() *mirrorStats {
+	return &mirrorStats{
+		speeds: make(map[string]float64),
+		failed: make(map[string]time.Time),
+	}
+}
+
+// rank returns the URLs ordered from the best mirror to the worst: hosts that failed recently go last, and the others
+// are sorted by their measured speed; hosts that were never measured keep their order, after the measured ones.
+func (m *mirrorStats) rank(urls []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	score := func(rawUrl string) (int, float64) {
+		host := urlHost(rawUrl)
+		if failedAt, exists := m.failed[host]; exists && now.Sub(failedAt) < mirrorFailurePenalty {
+			return 2, 0
+		}
+
+		if speed, exists := m.speeds[host]; exists {
+			return 0, speed
+		}
+
+		return 1, 0
+	}
+
+	ranked := slices.Clone(urls)
+	slices.SortStableFunc(ranked, func(a, b string) int {
+		groupA, speedA := score(a)
+		groupB, speedB := score(b)
+
+		switch {
+		case groupA != groupB:
+			return groupA - groupB
+		case speedA > speedB:
+			return -1
+		case speedA < speedB:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return ranked
+}
+
+// record adds a measured download speed to the average speed of the host.
+func (m *mirrorStats) record(rawUrl string, bytes int64, elapsed time.Duration) {
+	if bytes <= 0 || elapsed <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	host := urlHost(rawUrl)
+	speed := float64(bytes) / elapsed.Seconds()
+	if previous, exists := m.speeds[host]; exists {
+		speed = previous + mirrorSpeedSmoothing*(speed-previous)
+	}
+
+	m.speeds[host] = speed
+	delete(m.failed, host)
+}
+
+// fail marks the host as failed, so it's tried after the other mirrors for a while.
+func (m *mirrorStats) fail(rawUrl string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failed[urlHost(rawUrl)] = time.Now()
+}
+
+// mirrorList is the list of URLs of a single download, with the one being used.
+type mirrorList struct {
+	urls  []string
+	index int
+
+	// switched counts the mirrors that failed in a row; when all of them failed, the retry policy decides what to do
+	switched int
+}
+
+// newMirrorList creates the list of URLs of the request, from the best mirror to the worst.
+func (f *Fetch) newMirrorList(request *Request) *mirrorList {
+	if len(request.Mirrors) == 0 {
+		return &mirrorList{urls: []string{request.Url}}
+	}
+
+	urls := []string{request.Url}
+	for _, mirror := range request.Mirrors {
+		if !slices.Contains(urls, mirror) {
+			urls = append(urls, mirror)
+		}
+	}
+
+	return &mirrorList{urls: f.mirrors.rank(urls)}
+}
+
+func (m *mirrorList) current() string {
+	return m.urls[m.index]
+}
+
+// next moves to the next mirror. It returns false when all mirrors failed in a row, or there are no mirrors.
+func (m *mirrorList) next() bool {
+	if len(m.urls) < 2 {
+		return false
+	}
+
+	m.index = (m.index + 1) % len(m.urls)
+	m.switched++
+
+	if m.switched >= len(m.urls) {
+		m.switched = 0
+		return false
+	}
+
+	return true
+}
+
+// region - Private functions
+
+// useMirror makes the request download the file from the current mirror.
+func useMirror(request *Request, mirrors *mirrorList) error {
+	if request.httpReq.URL.String() == mirrors.current() {
+		return nil
+	}
+
+	mirrorUrl, err := url.Parse(mirrors.current())
+	if err != nil {
+		return fmt.Errorf("invalid mirror '%s': %w", mirrors.current(), err)
+	}
+
+	request.httpReq.URL = mirrorUrl
+	request.httpReq.Host = ""
+
+	return nil
+}
+
+// failOver switches the download to the next mirror after a connection error, an interrupted body or a server error.
+// It returns false when there's no other mirror to try now, so the retry policy decides if the download is tried again.
+func (f *Fetch) failOver(response *Response, mirrors *mirrorList) bool {
+	if len(mirrors.urls) < 2 {
+		return false
+	}
+
+	failed := mirrors.current()
+	f.mirrors.fail(failed)
+	switched := mirrors.next()
+
+	if err := useMirror(response.Request, mirrors); err != nil {
+		response.err = err
+		return false
+	}
+
+	log.WithFields(log.Fields{
+		"error":  response.err,
+		"failed": failed,
+		"mirror": mirrors.current(),
+		"url":    response.Request.Url,
+	}).Warn("failed to download file from mirror; switching to another one")
+
+	return switched
+}
+
+func urlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	return u.Host
+}
+
+// endregion
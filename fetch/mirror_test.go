@@ -0,0 +1,122 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch_DownloadFile_Mirrors(t *testing.T) {
+	var downHits, goodHits atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodHits.Add(1)
+		w.Write([]byte("file content"))
+	}))
+	defer good.Close()
+
+	// The connection to this one is refused
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0)
+
+	request, _ := fetch.NewRequest(down.URL+"/file.txt", filepath.Join(dir, "first.txt"))
+	request.Mirrors = []string{closed.URL + "/file.txt", good.URL + "/file.txt"}
+
+	// Switching mirrors doesn't count as a retry, so it works even without retries
+	start := time.Now()
+	resp := fetch.DownloadFile(request)
+	assert.NoError(t, resp.Error())
+	assert.Less(t, time.Since(start), time.Second)
+
+	data, _ := os.ReadFile(filepath.Join(dir, "first.txt"))
+	assert.Equal(t, "file content", string(data))
+	assert.Equal(t, int32(1), downHits.Load())
+
+	// The mirrors that failed are not tried first anymore
+	request, _ = fetch.NewRequest(down.URL+"/file.txt", filepath.Join(dir, "second.txt"))
+	request.Mirrors = []string{closed.URL + "/file.txt", good.URL + "/file.txt"}
+
+	assert.NoError(t, fetch.DownloadFile(request).Error())
+	assert.Equal(t, int32(1), downHits.Load())
+	assert.Equal(t, int32(2), goodHits.Load())
+}
+
+func TestFetch_DownloadFile_MirrorsFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL+"/a.txt", filepath.Join(t.TempDir(), "file.txt"))
+	request.Mirrors = []string{server.URL + "/b.txt"}
+
+	resp := fetch.DownloadFile(request)
+	assert.Error(t, resp.Error())
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestMirrorStats_Rank(t *testing.T) {
+	stats := newMirrorStats()
+	urls := []string{"https://n1.host/a", "https://n2.host/a", "https://n3.host/a", "https://n4.host/a"}
+
+	// Without measures, the order doesn't change
+	assert.Equal(t, urls, stats.rank(urls))
+
+	stats.record("https://n3.host/b", 1000, time.Second)
+	stats.record("https://n4.host/b", 5000, time.Second)
+	stats.fail("https://n1.host/c")
+
+	expected := []string{"https://n4.host/a", "https://n3.host/a", "https://n2.host/a", "https://n1.host/a"}
+	assert.Equal(t, expected, stats.rank(urls))
+}
+
+func TestFetch_DownloadFile_MirrorsInterrupted(t *testing.T) {
+	var flakyHits atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flakyHits.Add(1)
+
+		// The connection drops after part of the file is sent
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte("file"))
+		w.(http.Flusher).Flush()
+
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer flaky.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("file content"))
+	}))
+	defer good.Close()
+
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(flaky.URL+"/file.txt", filePath)
+	request.Mirrors = []string{good.URL + "/file.txt"}
+
+	// The download switches to the other mirror right away, instead of retrying the same one
+	start := time.Now()
+	resp := fetch.DownloadFile(request)
+	assert.NoError(t, resp.Error())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), flakyHits.Load())
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, "file content", string(data))
+}
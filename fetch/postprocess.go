@@ -0,0 +1,107 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PostProcessor is a step that runs after a file is downloaded, before the download is complete. It runs for every
+// download that finishes without errors, including the ones skipped because the file already exists; when it returns an
+// error, the next steps are not run and the download fails with it.
+//
+// # Parameters:
+//   - ctx: the context of the download; the step should stop when it's canceled.
+//   - response: the download; the file is in FilePath, and the media used to create the request, if any, is in
+//     Request.Media.
+type PostProcessor func(ctx context.Context, response *Response) error
+
+// MediaTimeProcessor returns a PostProcessor that sets the modification time of the file to the time the media was
+// created, from Metadata["created"] of Request.Media. Files without a media, or without a created time, are not
+// changed; neither are files whose created time is in the future, or is marked as synthetic by the extractor, with
+// Metadata["created_synthetic"], because the site doesn't say when the media was published.
+//
+// # Parameters:
+//   - accessTime: if true, the access time of the file is also set to the created time.
+func MediaTimeProcessor(accessTime bool) PostProcessor {
+	return func(_ context.Context, response *Response) error {
+		if response.Request.Media == nil {
+			return nil
+		}
+
+		created, ok := mediaCreated(response.Request.Media.Metadata)
+		if !ok {
+			return nil
+		}
+
+		// The zero time leaves the access time unchanged
+		var atime time.Time
+		if accessTime {
+			atime = created
+		}
+
+		if err := os.Chtimes(response.FilePath, atime, created); err != nil {
+			return fmt.Errorf("could not set file time: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// region - Private functions
+
+// postProcess runs the post processors of the Fetch instance in the download, if it was successful.
+func (f *Fetch) postProcess(ctx context.Context, response *Response) {
+	if response.err != nil || len(f.postProcessors) == 0 {
+		return
+	}
+
+	for _, processor := range f.postProcessors {
+		if err := processor(ctx, response); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  response.FilePath,
+				"url":   response.Request.Url,
+			}).Warn("failed to post-process downloaded file")
+
+			response.err = fmt.Errorf("post-processing failed: %w", err)
+			return
+		}
+	}
+}
+
+// mediaCreated returns the time the media was created, from its metadata; times made up by the extractor, marked with
+// "created_synthetic", are ignored.
+func mediaCreated(metadata map[string]interface{}) (time.Time, bool) {
+	if synthetic, _ := metadata["created_synthetic"].(bool); synthetic {
+		return time.Time{}, false
+	}
+
+	return mediaTime(metadata["created"])
+}
+
+// mediaTime returns the time in the metadata value; times restored from JSON, like the ones in a Queue, are strings.
+// Times in the future are not real creation times, so they are ignored.
+func mediaTime(value interface{}) (time.Time, bool) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		t = parsed
+	default:
+		return time.Time{}, false
+	}
+
+	return t, !t.IsZero() && !t.After(time.Now())
+}
+
+// endregion
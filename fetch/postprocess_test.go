@@ -0,0 +1,108 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+func TestMediaTimeProcessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image content"))
+	}))
+	defer server.Close()
+
+	created := time.Date(2020, time.May, 17, 10, 30, 0, 0, time.UTC)
+	media := []model.Media{
+		model.NewMedia(server.URL+"/image.jpg", model.Reddit, map[string]interface{}{"created": created}),
+		model.NewMedia(server.URL+"/other.jpg", model.Reddit, nil),
+		model.NewMedia(server.URL+"/future.jpg", model.Reddit, map[string]interface{}{
+			"created": time.Now().Add(24 * time.Hour),
+		}),
+		model.NewMedia(server.URL+"/synthetic.jpg", model.Fapello, map[string]interface{}{
+			"created":           created,
+			"created_synthetic": true,
+		}),
+	}
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithPostProcessors(MediaTimeProcessor(true)))
+	template, _ := ParsePathTemplate("{filename}.{ext}")
+	requests, _ := fetch.NewMediaRequests(media, dir, template)
+
+	for _, request := range requests {
+		assert.NoError(t, fetch.DownloadFile(request).Error())
+	}
+
+	info, _ := os.Stat(filepath.Join(dir, "image.jpg"))
+	assert.True(t, created.Equal(info.ModTime()))
+
+	// Media without a created time keep the time of the download
+	info, _ = os.Stat(filepath.Join(dir, "other.jpg"))
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+
+	// Times in the future are ignored, so the files still sort by when they were downloaded
+	info, _ = os.Stat(filepath.Join(dir, "future.jpg"))
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+
+	// Times made up by the extractor are not the real time of the media
+	info, _ = os.Stat(filepath.Join(dir, "synthetic.jpg"))
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+}
+
+func TestFetch_PostProcessors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+
+	steps := make([]string, 0)
+	first := func(_ context.Context, response *Response) error {
+		data, _ := os.ReadFile(response.FilePath)
+		steps = append(steps, string(data))
+		return errors.New("broken file")
+	}
+
+	second := func(_ context.Context, _ *Response) error {
+		steps = append(steps, "second")
+		return nil
+	}
+
+	fetch := New(nil, 0, WithPostProcessors(first, second))
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "file.txt"))
+	resp := fetch.DownloadFile(request)
+
+	// The steps stop at the first error, which fails the download
+	assert.ErrorContains(t, resp.Error(), "broken file")
+	assert.Equal(t, []string{"file content"}, steps)
+}
+
+func TestMediaTime(t *testing.T) {
+	created := time.Date(2020, time.May, 17, 10, 30, 0, 0, time.UTC)
+
+	value, ok := mediaTime(created)
+	assert.True(t, ok)
+	assert.Equal(t, created, value)
+
+	// Times restored from JSON
+	value, ok = mediaTime("2020-05-17T10:30:00Z")
+	assert.True(t, ok)
+	assert.True(t, created.Equal(value))
+
+	_, ok = mediaTime(time.Time{})
+	assert.False(t, ok)
+
+	_, ok = mediaTime(12345)
+	assert.False(t, ok)
+
+	_, ok = mediaTime(time.Now().Add(time.Hour))
+	assert.False(t, ok)
+}
@@ -0,0 +1,330 @@
+package fetch
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// speedWindow is the minimum time between two samples of the download speed.
+	speedWindow = 500 * time.Millisecond
+
+	// speedSmoothing is the weight of a new sample in the moving average of the download speed; lower values make the
+	// speed, and the ETA, more stable.
+	speedSmoothing = 0.3
+)
+
+// ResponseStats is a snapshot of the progress of a Response.
+type ResponseStats struct {
+	// Size is the size of the file, in bytes; zero before the server responds, and -1 when the server doesn't send it.
+	Size int64
+
+	// Downloaded is the number of bytes of the file that are on the disk, including the ones from a previous attempt
+	// that was resumed.
+	Downloaded int64
+
+	// Progress is the fraction of the file that is downloaded, from 0 to 1.
+	Progress float64
+
+	// Speed is the current download speed, in bytes per second; zero when the download is complete.
+	Speed float64
+
+	// ETA is the estimated time until the download is complete; -1 when it can't be estimated, and zero when the
+	// download is complete.
+	ETA time.Duration
+
+	// Complete is true when the download stopped, successfully or not.
+	Complete bool
+
+	// Canceled is true when the download was stopped by Response.Cancel.
+	Canceled bool
+
+	// Paused is true when the download was stopped by Manager.Pause; it continues in a new Response once resumed.
+	Paused bool
+
+	// Err is the error that stopped the download, if it's complete.
+	Err error
+}
+
+// Stats returns a snapshot of the progress of the download. It's safe to call it from any goroutine, while the download
+// runs.
+func (r *Response) Stats() ResponseStats {
+	stats := ResponseStats{
+		Size:       r.size.Load(),
+		Downloaded: r.downloaded.Load(),
+		Complete:   r.IsComplete(),
+		Canceled:   r.canceled.Load(),
+		Paused:     r.paused.Load(),
+	}
+
+	if stats.Complete {
+		stats.Err = r.err
+		if stats.Err == nil {
+			stats.Progress = 1
+		}
+	} else {
+		stats.Speed = r.meter.speed()
+	}
+
+	if stats.Progress == 0 && stats.Size > 0 {
+		stats.Progress = min(float64(stats.Downloaded)/float64(stats.Size), 1)
+	}
+
+	switch {
+	case stats.Complete:
+		stats.ETA = 0
+	case stats.Size <= 0:
+		stats.ETA = -1
+	default:
+		stats.ETA = estimate(stats.Size-stats.Downloaded, stats.Speed)
+	}
+
+	return stats
+}
+
+// Speed returns the current download speed, in bytes per second, smoothed over the last seconds; see Stats.
+func (r *Response) Speed() float64 {
+	return r.Stats().Speed
+}
+
+// ETA returns the estimated time until the download is complete, based on the current speed; see Stats.
+func (r *Response) ETA() time.Duration {
+	return r.Stats().ETA
+}
+
+// BatchStats is a snapshot of the progress of a Batch.
+type BatchStats struct {
+	// Files is the number of files in the batch.
+	Files int
+
+	// Done is the number of files downloaded successfully, including the ones skipped because they already exist.
+	Done int
+
+	// Failed is the number of files that failed or were canceled.
+	Failed int
+
+	// Active is the number of files being downloaded.
+	Active int
+
+	// Pending is the number of files waiting to be downloaded.
+	Pending int
+
+	// Downloaded is the number of bytes downloaded by all files.
+	Downloaded int64
+
+	// Total is the estimated number of bytes of all files. The size of the files that were not started yet comes from
+	// Request.ExpectedSize, or from the average size of the completed files, so it can change as the batch runs.
+	Total int64
+
+	// Speed is the sum of the current speed, in bytes per second, of the active files.
+	Speed float64
+
+	// ETA is the estimated time until the batch is complete, or -1 when it can't be estimated yet.
+	ETA time.Duration
+}
+
+// Batch is a group of files downloaded concurrently by Fetch.DownloadBatch.
+type Batch struct {
+	results <-chan *Response
+	done    <-chan struct{}
+	cancel  func()
+
+	mu        sync.Mutex
+	requests  []*Request
+	responses map[*Request]*Response
+}
+
+// DownloadBatch downloads multiple files concurrently, like DownloadFiles, but it also reports the progress of the whole
+// batch through Batch.Stats and Batch.Track.
+//
+// # Parameters:
+//   - requests: a slice of *Request objects representing the files to download.
+//   - parallel: the maximum number of concurrent downloads.
+//
+// # Returns:
+//   - A Batch with the responses and the progress of the downloads.
+func (f *Fetch) DownloadBatch(requests []*Request, parallel int) *Batch {
+	b := &Batch{
+		requests:  requests,
+		responses: make(map[*Request]*Response),
+	}
+
+	b.results, b.cancel, b.done = f.downloadAll(requests, parallel, func(response *Response) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.responses[response.Request] = response
+	})
+
+	return b
+}
+
+// Responses returns a channel with the Response of each file, sent as soon as its download starts. The channel is
+// closed when all downloads are complete.
+func (b *Batch) Responses() <-chan *Response {
+	return b.results
+}
+
+// Cancel stops all downloads in the batch; the files that were not started yet are not downloaded.
+func (b *Batch) Cancel() {
+	b.cancel()
+}
+
+// Stats returns a snapshot of the progress of the batch.
+func (b *Batch) Stats() BatchStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BatchStats{Files: len(b.requests)}
+
+	var completedSize, unknownSizes int64
+	for _, request := range b.requests {
+		response, started := b.responses[request]
+
+		var current ResponseStats
+		if started {
+			current = response.Stats()
+		}
+
+		switch {
+		case !started:
+			stats.Pending++
+			if request.ExpectedSize > 0 {
+				stats.Total += request.ExpectedSize
+			} else {
+				unknownSizes++
+			}
+
+			continue
+
+		case !current.Complete:
+			stats.Active++
+			stats.Speed += current.Speed
+
+		case current.Err != nil:
+			stats.Failed++
+
+		default:
+			stats.Done++
+			completedSize += current.Size
+		}
+
+		stats.Downloaded += current.Downloaded
+		if current.Size > 0 {
+			stats.Total += current.Size
+		} else if request.ExpectedSize > 0 {
+			stats.Total += request.ExpectedSize
+		} else {
+			unknownSizes++
+		}
+	}
+
+	// Files with unknown size are estimated to be like the files that were already downloaded
+	if unknownSizes > 0 {
+		if stats.Done == 0 {
+			stats.ETA = -1
+			return stats
+		}
+
+		stats.Total += unknownSizes * completedSize / int64(stats.Done)
+	}
+
+	stats.ETA = estimate(stats.Total-stats.Downloaded, stats.Speed)
+	if stats.Active+stats.Pending == 0 {
+		stats.ETA = 0
+	}
+
+	return stats
+}
+
+// Track monitors the progress of the batch and invokes the callback with a snapshot of its stats, periodically, until
+// all downloads are complete; the last call has the final stats. The responses must still be read from
+// Batch.Responses, otherwise the downloads don't continue.
+//
+// # Parameters:
+//   - callback: a function that receives the BatchStats.
+func (b *Batch) Track(callback func(stats BatchStats)) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			callback(b.Stats())
+
+		case <-b.done:
+			callback(b.Stats())
+			return
+		}
+	}
+}
+
+// region - Private functions
+
+// addDownloaded records bytes written to the file.
+func (r *Response) addDownloaded(n int64) {
+	r.meter.add(n)
+	r.downloaded.Add(n)
+}
+
+// speedMeter measures the speed of a download with an exponential moving average of the bytes received in each window.
+type speedMeter struct {
+	mu      sync.Mutex
+	start   time.Time
+	bytes   int64
+	rate    float64
+	sampled bool
+}
+
+func newSpeedMeter() *speedMeter {
+	return &speedMeter{start: time.Now()}
+}
+
+// add records bytes received by the download.
+func (m *speedMeter) add(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes += n
+	m.sample(time.Now())
+}
+
+func (m *speedMeter) speed() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sample(time.Now())
+	return m.rate
+}
+
+// sample updates the moving average when the current window is over. Long windows, when no data was received for a
+// while, weigh as much as the short windows they contain, so the speed drops quickly when the download stalls.
+func (m *speedMeter) sample(now time.Time) {
+	elapsed := now.Sub(m.start)
+	if elapsed < speedWindow {
+		return
+	}
+
+	current := float64(m.bytes) / elapsed.Seconds()
+	if m.sampled {
+		weight := 1 - math.Pow(1-speedSmoothing, float64(elapsed)/float64(speedWindow))
+		m.rate += weight * (current - m.rate)
+	} else {
+		m.rate = current
+		m.sampled = true
+	}
+
+	m.start = now
+	m.bytes = 0
+}
+
+// estimate returns the time needed to download the remaining bytes at the speed, or -1 if it can't be estimated.
+func estimate(remaining int64, speed float64) time.Duration {
+	if remaining < 0 || speed <= 0 {
+		return -1
+	}
+
+	return time.Duration(float64(remaining) / speed * float64(time.Second))
+}
+
+// endregion
@@ -0,0 +1,121 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeedMeter(t *testing.T) {
+	start := time.Now()
+	meter := &speedMeter{start: start}
+
+	// Samples are only taken when the window is over
+	meter.bytes = 1000
+	meter.sample(start.Add(100 * time.Millisecond))
+	assert.Equal(t, 0.0, meter.rate)
+
+	meter.sample(start.Add(time.Second))
+	assert.Equal(t, 1000.0, meter.rate)
+
+	// A stalled download makes the speed drop quickly
+	meter.sample(start.Add(6 * time.Second))
+	assert.Less(t, meter.rate, 50.0)
+}
+
+func TestEstimate(t *testing.T) {
+	assert.Equal(t, 10*time.Second, estimate(1000, 100))
+	assert.Equal(t, time.Duration(-1), estimate(1000, 0))
+	assert.Equal(t, time.Duration(-1), estimate(-1, 100))
+}
+
+func TestFetch_DownloadBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Repeat("a", 1000)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0)
+
+	requests := make([]*Request, 0)
+	for i, path := range []string{"/1", "/2", "/missing"} {
+		request, _ := fetch.NewRequest(server.URL+path, filepath.Join(dir, fmt.Sprintf("file%d.txt", i)))
+		requests = append(requests, request)
+	}
+
+	batch := fetch.DownloadBatch(requests, 2)
+	assert.Equal(t, 3, batch.Stats().Files)
+
+	go func() {
+		for range batch.Responses() {
+		}
+	}()
+
+	var last BatchStats
+	batch.Track(func(stats BatchStats) {
+		last = stats
+	})
+
+	assert.Equal(t, 2, last.Done)
+	assert.Equal(t, 1, last.Failed)
+	assert.Equal(t, 0, last.Active+last.Pending)
+	assert.Equal(t, int64(2000), last.Downloaded)
+	assert.Equal(t, time.Duration(0), last.ETA)
+}
+
+func TestResponse_Stats(t *testing.T) {
+	content := strings.Repeat("a", 64*1024)
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content[:1024]))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+			w.Write([]byte(content[1024:]))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	fetch := New(nil, 0)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "file.bin"))
+	resp := fetch.DownloadFile(request)
+
+	// Read from another goroutine while the download runs
+	assert.Eventually(t, func() bool {
+		return resp.Stats().Downloaded == 1024
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := resp.Stats()
+	assert.Equal(t, int64(len(content)), stats.Size)
+	assert.InDelta(t, 1024.0/float64(len(content)), stats.Progress, 0.001)
+	assert.False(t, stats.Complete)
+	assert.False(t, stats.Canceled)
+
+	resp.Cancel()
+	<-resp.Done
+
+	stats = resp.Stats()
+	assert.True(t, stats.Complete)
+	assert.True(t, stats.Canceled)
+	assert.Error(t, stats.Err)
+	assert.Equal(t, time.Duration(0), stats.ETA)
+}
@@ -0,0 +1,505 @@
+package fetch
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+// QueueStatus is the state of an item in a Queue.
+type QueueStatus int
+
+const (
+	// QueuePending is an item waiting to be downloaded.
+	QueuePending QueueStatus = iota
+	// QueueDownloading is an item being downloaded.
+	QueueDownloading
+	// QueueDone is an item that was downloaded successfully.
+	QueueDone
+	// QueueFailed is an item whose download failed, even after all retries.
+	QueueFailed
+)
+
+func (s QueueStatus) String() string {
+	switch s {
+	case QueuePending:
+		return "Pending"
+	case QueueDownloading:
+		return "Downloading"
+	case QueueDone:
+		return "Done"
+	case QueueFailed:
+		return "Failed"
+	}
+
+	return "Unknown"
+}
+
+// QueueItem is a download saved in a Queue, with everything needed to create its Request again after a restart.
+type QueueItem struct {
+	Id             string             `json:"id"`
+	Url            string             `json:"url"`
+	FilePath       string             `json:"filePath"`
+	ExpectedSize   int64              `json:"expectedSize,omitempty"`
+	ExpectedHash   string             `json:"expectedHash,omitempty"`
+	ExistingFile   ExistingFilePolicy `json:"existingFile,omitempty"`
+	BandwidthLimit int64              `json:"bandwidthLimit,omitempty"`
+	Segments       int                `json:"segments,omitempty"`
+	Mirrors        []string           `json:"mirrors,omitempty"`
+	Media          *model.Media       `json:"media,omitempty"`
+
+	Status    QueueStatus `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	AddedAt   time.Time   `json:"addedAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// timeMetadataKeys are the keys of the media metadata that have a time.Time, which is saved as a string in the queue.
+var timeMetadataKeys = []string{"created"}
+
+// Queue is a list of downloads saved in a file, so pending, partially downloaded and failed downloads are not lost when
+// the process stops. Opening the queue again, and calling Start, resumes the downloads that were not finished.
+//
+// The file is a journal in the JSON Lines format, where every change of an item appends its new state; the journal is
+// compacted every time the queue is opened.
+type Queue struct {
+	fetch    *Fetch
+	filePath string
+
+	mu      sync.Mutex
+	items   []*QueueItem
+	index   map[string]*QueueItem
+	journal *os.File
+}
+
+// OpenQueue opens, or creates, a queue saved in a file. Items that were being downloaded when the process stopped go
+// back to the pending state, and their partial downloads are resumed when the queue is started.
+//
+// # Parameters:
+//   - filePath: the path of the file where the queue is saved.
+//
+// # Returns:
+//   - The Queue.
+//   - An error if the file can't be read or written.
+func (f *Fetch) OpenQueue(filePath string) (*Queue, error) {
+	q := &Queue{
+		fetch:    f,
+		filePath: filePath,
+		items:    make([]*QueueItem, 0),
+		index:    make(map[string]*QueueItem),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Enqueue adds requests to the queue as pending items. Requests already in the queue, with the same URL and file path,
+// are ignored, unless they failed, in which case they are pending again.
+//
+// # Parameters:
+//   - requests: the requests to be downloaded.
+//
+// # Returns:
+//   - An error if the queue can't be saved.
+func (q *Queue) Enqueue(requests ...*Request) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+
+	for _, request := range requests {
+		id := queueItemId(request.Url, request.FilePath)
+
+		if item, exists := q.index[id]; exists {
+			if item.Status != QueueFailed {
+				continue
+			}
+
+			item.Status = QueuePending
+			item.Error = ""
+			item.UpdatedAt = now
+			if err := q.write(item); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		item := &QueueItem{
+			Id:             id,
+			Url:            request.Url,
+			FilePath:       request.FilePath,
+			ExpectedSize:   request.ExpectedSize,
+			ExpectedHash:   request.ExpectedHash,
+			ExistingFile:   request.ExistingFile,
+			BandwidthLimit: request.BandwidthLimit,
+			Segments:       request.Segments,
+			Mirrors:        request.Mirrors,
+			Media:          request.Media,
+			Status:         QueuePending,
+			AddedAt:        now,
+			UpdatedAt:      now,
+		}
+
+		q.items = append(q.items, item)
+		q.index[id] = item
+
+		if err := q.write(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Items returns a copy of all the items in the queue, in the order they were added.
+func (q *Queue) Items() []QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]QueueItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+
+	return items
+}
+
+// RetryFailed sets all the failed items as pending again, so they are downloaded the next time the queue is started.
+func (q *Queue) RetryFailed() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.items {
+		if item.Status == QueueFailed {
+			if err := q.setStatus(item, QueuePending, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Start downloads the pending items of the queue concurrently, updating the state of each item as they are downloaded.
+// It stops once there are no pending items left.
+//
+// # Parameters:
+//   - parallel: the maximum number of concurrent downloads.
+//
+// # Returns:
+//   - A channel of *Response objects, where each response corresponds to an item of the queue; it's closed when all
+//     downloads are complete.
+//   - A function that can be called to stop all downloads; the items being downloaded go back to the pending state.
+func (q *Queue) Start(parallel int) (<-chan *Response, func()) {
+	result := make(chan *Response)
+	done := make(chan struct{})
+
+	var (
+		wg        sync.WaitGroup
+		stopOnce  sync.Once
+		cancelsMu sync.Mutex
+		cancels   = make(map[*Response]func())
+	)
+
+	stop := func() {
+		stopOnce.Do(func() { close(done) })
+
+		cancelsMu.Lock()
+		defer cancelsMu.Unlock()
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+
+	for i := 0; i < max(parallel, 1); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				item, request, err := q.next()
+				if err != nil {
+					log.WithFields(log.Fields{
+						"error": err,
+						"file":  q.filePath,
+					}).Error("failed to update queue")
+
+					return
+				}
+
+				if item == nil {
+					return
+				}
+
+				resp := q.fetch.DownloadFile(request)
+
+				cancelsMu.Lock()
+				cancels[resp] = resp.cancel
+				cancelsMu.Unlock()
+
+				select {
+				case result <- resp:
+				case <-done:
+					resp.cancel()
+				}
+
+				dErr := resp.Error()
+
+				cancelsMu.Lock()
+				delete(cancels, resp)
+				cancelsMu.Unlock()
+
+				q.finish(item, resp, dErr, done)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(result)
+	}()
+
+	return result, stop
+}
+
+// Close closes the file of the queue.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.journal.Close()
+}
+
+// region - Private functions
+
+func queueItemId(url string, filePath string) string {
+	sum := sha1.Sum([]byte(url + "\n" + filePath))
+	return hex.EncodeToString(sum[:8])
+}
+
+// load replays the journal; the last state of each item wins.
+func (q *Queue) load() error {
+	file, err := os.Open(q.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not open queue: %w", err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var item QueueItem
+		if err = json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			// The last line may be incomplete if the process stopped while writing it
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  q.filePath,
+			}).Warn("ignoring invalid queue entry")
+
+			continue
+		}
+
+		if item.Status == QueueDownloading {
+			item.Status = QueuePending
+		}
+
+		if item.Media != nil {
+			restoreTimes(item.Media.Metadata)
+		}
+
+		if existing, exists := q.index[item.Id]; exists {
+			*existing = item
+		} else {
+			q.items = append(q.items, &item)
+			q.index[item.Id] = &item
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("could not read queue: %w", err)
+	}
+
+	return nil
+}
+
+// compact rewrites the journal with only the current state of each item, and keeps it open for appending.
+func (q *Queue) compact() error {
+	if err := os.MkdirAll(filepath.Dir(q.filePath), 0o755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(q.filePath), filepath.Base(q.filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create queue: %w", err)
+	}
+
+	defer os.Remove(temp.Name())
+
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+
+	for _, item := range q.items {
+		if err = encoder.Encode(item); err != nil {
+			temp.Close()
+			return fmt.Errorf("could not encode queue item: %w", err)
+		}
+	}
+
+	// The data must be on the disk before the rename, otherwise a crash can leave an empty queue
+	if err = writer.Flush(); err == nil {
+		err = temp.Sync()
+	}
+
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write queue: %w", err)
+	}
+
+	if err = os.Rename(temp.Name(), q.filePath); err != nil {
+		return fmt.Errorf("could not save queue: %w", err)
+	}
+
+	q.journal, err = os.OpenFile(q.filePath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open queue: %w", err)
+	}
+
+	return nil
+}
+
+// write appends the current state of the item to the journal; the caller must hold the lock.
+func (q *Queue) write(item *QueueItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("could not encode queue item: %w", err)
+	}
+
+	if _, err = q.journal.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write queue: %w", err)
+	}
+
+	return nil
+}
+
+// setStatus updates the status of the item and saves it; the caller must hold the lock.
+func (q *Queue) setStatus(item *QueueItem, status QueueStatus, err error) error {
+	item.Status = status
+	item.Error = ""
+	if err != nil {
+		item.Error = err.Error()
+	}
+
+	item.UpdatedAt = time.Now()
+	return q.write(item)
+}
+
+// next takes the first pending item and marks it as downloading. It returns a nil item when there's nothing pending.
+func (q *Queue) next() (*QueueItem, *Request, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.items {
+		if item.Status != QueuePending {
+			continue
+		}
+
+		request, err := q.fetch.NewRequest(item.Url, item.FilePath)
+		if err != nil {
+			if sErr := q.setStatus(item, QueueFailed, err); sErr != nil {
+				return nil, nil, sErr
+			}
+
+			continue
+		}
+
+		request.ExpectedSize = item.ExpectedSize
+		request.ExpectedHash = item.ExpectedHash
+		request.ExistingFile = item.ExistingFile
+		request.BandwidthLimit = item.BandwidthLimit
+		request.Segments = item.Segments
+		request.Mirrors = item.Mirrors
+		request.Media = item.Media
+
+		if err = q.setStatus(item, QueueDownloading, nil); err != nil {
+			return nil, nil, err
+		}
+
+		return item, request, nil
+	}
+
+	return nil, nil, nil
+}
+
+// finish saves the result of the download; downloads stopped by the queue go back to the pending state.
+func (q *Queue) finish(item *QueueItem, response *Response, err error, done <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := QueueDone
+	if err != nil {
+		status = QueueFailed
+
+		select {
+		case <-done:
+			status, err = QueuePending, nil
+		default:
+		}
+	}
+
+	// The file may have been renamed because of the ExistingFileRename policy
+	item.FilePath = response.FilePath
+
+	if sErr := q.setStatus(item, status, err); sErr != nil {
+		log.WithFields(log.Fields{
+			"error": sErr,
+			"file":  q.filePath,
+		}).Error("failed to update queue")
+	}
+}
+
+// restoreTimes converts the time values of the metadata, saved as RFC 3339 strings, back to time.Time. Only the keys in
+// timeMetadataKeys are converted, so other strings that just look like a date are kept as they are.
+func restoreTimes(metadata map[string]interface{}) {
+	for _, key := range timeMetadataKeys {
+		if s, ok := metadata[key].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				metadata[key] = t
+			}
+		}
+	}
+}
+
+// endregion
@@ -0,0 +1,146 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+func TestQueue_Start(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	queuePath := filepath.Join(dir, "queue.jsonl")
+	fetch := New(nil, 0)
+
+	queue, err := fetch.OpenQueue(queuePath)
+	assert.NoError(t, err)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first, _ := fetch.NewRequest(server.URL+"/first", filepath.Join(dir, "first.txt"))
+	first.Media = &model.Media{Url: first.Url, Metadata: map[string]interface{}{
+		"created": created,
+		"title":   "2024-05-01T12:00:00Z",
+	}}
+	second, _ := fetch.NewRequest(server.URL+"/second", filepath.Join(dir, "second.txt"))
+	missing, _ := fetch.NewRequest(server.URL+"/missing", filepath.Join(dir, "missing.txt"))
+
+	assert.NoError(t, queue.Enqueue(first, second, missing))
+	assert.NoError(t, queue.Enqueue(first))
+	assert.Len(t, queue.Items(), 3)
+
+	responses, _ := queue.Start(2)
+	count := 0
+	for range responses {
+		count++
+	}
+
+	assert.Equal(t, 3, count)
+	assert.NoError(t, queue.Close())
+
+	// The state is kept after the queue is opened again
+	queue, err = fetch.OpenQueue(queuePath)
+	assert.NoError(t, err)
+	defer queue.Close()
+
+	items := queue.Items()
+	assert.Equal(t, QueueDone, items[0].Status)
+	assert.Equal(t, created, items[0].Media.Metadata["created"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", items[0].Media.Metadata["title"])
+	assert.Equal(t, QueueDone, items[1].Status)
+	assert.Equal(t, QueueFailed, items[2].Status)
+	assert.Equal(t, "unexpected status: 404", items[2].Error)
+
+	data, _ := os.ReadFile(filepath.Join(dir, "second.txt"))
+	assert.Equal(t, "content of /second", string(data))
+
+	// Failed items can be retried
+	assert.NoError(t, queue.RetryFailed())
+	assert.Equal(t, QueuePending, queue.Items()[2].Status)
+}
+
+func TestQueue_ResumeAfterRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	queuePath := filepath.Join(dir, "queue.jsonl")
+	filePath := filepath.Join(dir, "file.txt")
+
+	// The process stopped while the item was being downloaded, and the last line was not completely written
+	id := queueItemId(server.URL, filePath)
+	journal := `{"id":"` + id + `","url":"` + server.URL + `","filePath":"` + filePath + `","status":0}` + "\n" +
+		`{"id":"` + id + `","url":"` + server.URL + `","filePath":"` + filePath + `","status":1}` + "\n" +
+		`{"id":"` + id + `","url":`
+	os.WriteFile(queuePath, []byte(journal), 0644)
+
+	fetch := New(nil, 0)
+	queue, err := fetch.OpenQueue(queuePath)
+	assert.NoError(t, err)
+	defer queue.Close()
+
+	assert.Equal(t, QueuePending, queue.Items()[0].Status)
+
+	responses, _ := queue.Start(1)
+	for resp := range responses {
+		assert.NoError(t, resp.Error())
+	}
+
+	assert.Equal(t, QueueDone, queue.Items()[0].Status)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, "file content", string(data))
+}
+
+func TestQueue_Stop(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	fetch := New(nil, 0)
+	queue, _ := fetch.OpenQueue(filepath.Join(dir, "queue.jsonl"))
+	defer queue.Close()
+
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(dir, "file.txt"))
+	queue.Enqueue(request)
+
+	responses, stop := queue.Start(1)
+	resp := <-responses
+	stop()
+
+	assert.Error(t, resp.Error())
+	for range responses {
+	}
+
+	// Stopped downloads are pending, so they are resumed the next time the queue starts
+	assert.Equal(t, QueuePending, queue.Items()[0].Status)
+}
@@ -0,0 +1,529 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecorderMode defines if a Recorder sends the requests to the network or answers them from its cassette.
+type RecorderMode int
+
+const (
+	// RecorderReplay answers all requests from the cassette, without using the network; requests that were not recorded
+	// fail with ErrNotRecorded.
+	RecorderReplay RecorderMode = iota
+
+	// RecorderRecord sends all requests to the network and saves them in a new cassette, replacing the old one.
+	RecorderRecord
+
+	// RecorderAuto answers the requests found in the cassette, and sends the other ones to the network, adding them to
+	// the cassette.
+	RecorderAuto
+)
+
+func (m RecorderMode) String() string {
+	switch m {
+	case RecorderReplay:
+		return "replay"
+	case RecorderRecord:
+		return "record"
+	case RecorderAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNotRecorded is returned, in replay mode, for requests that are not in the cassette.
+var ErrNotRecorded = errors.New("request not recorded in the cassette")
+
+// DefaultScrubbedHeaders are the headers whose values are never saved in a cassette, because they have tokens or
+// cookies.
+var DefaultScrubbedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie", "X-Api-Key"}
+
+// DefaultScrubbedFields are the fields of JSON bodies, form bodies and query strings whose values are never saved in a
+// cassette, because they have tokens, like the one returned by RedGifs' temporary authentication.
+var DefaultScrubbedFields = []string{"access_token", "refresh_token", "session", "token"}
+
+// DefaultMaxBodySize is the maximum size of the response bodies saved in a cassette, when RecorderOptions.MaxBodySize is
+// zero.
+const DefaultMaxBodySize = 1024 * 1024
+
+// scrubbedValue replaces the values of the scrubbed headers and fields in the cassette.
+const scrubbedValue = "[scrubbed]"
+
+// RecorderOptions configures what a Recorder saves in the cassette.
+type RecorderOptions struct {
+	// ScrubHeaders are headers whose values are not saved, in addition to DefaultScrubbedHeaders.
+	ScrubHeaders []string
+
+	// ScrubFields are fields whose values are not saved, in addition to DefaultScrubbedFields. They are scrubbed in the
+	// query string of the requests, in form bodies, and at any depth of JSON bodies, of both requests and responses.
+	ScrubFields []string
+
+	// ScrubBody, if set, changes the body of each request and response before it's saved, like removing a token from an
+	// HTML page. It runs after the fields in ScrubFields are scrubbed. Requests are matched by their scrubbed body, so
+	// it must always change the same body in the same way.
+	ScrubBody func(req *http.Request, body []byte) []byte
+
+	// MaxBodySize is the maximum size of the response bodies saved in the cassette. Larger bodies that are not text, like
+	// media files, are truncated; the caller still gets the whole body while recording, but only the beginning of it is
+	// replayed. Zero uses DefaultMaxBodySize, and a negative value saves the bodies whole.
+	MaxBodySize int64
+}
+
+// Recorder records the HTTP requests and responses of a Fetch instance in a cassette file, and replays them later, so
+// tests can run offline and get the same responses every time. Requests are matched by method, URL, body and Range
+// header, after they are scrubbed; when the same request is sent several times, the responses are replayed in the order
+// they were recorded.
+type Recorder struct {
+	path        string
+	mode        RecorderMode
+	scrub       map[string]bool
+	scrubFields map[string]bool
+	scrubBody   func(req *http.Request, body []byte) []byte
+	maxBodySize int64
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	replayed     map[string]int
+}
+
+// Interaction is a request and its response, saved in a cassette.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request saved in a cassette.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Url    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response saved in a cassette. Bodies that are not valid UTF-8 are saved in base64, and
+// Truncated is true when only the beginning of the body was saved; see RecorderOptions.MaxBodySize.
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"bodyBase64,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+}
+
+// NewRecorder creates a Recorder that uses the cassette in the path.
+//
+// # Parameters:
+//   - cassettePath: the path of the cassette file, in JSON.
+//   - mode: if the requests are replayed from the cassette or recorded.
+//   - options: what is saved in the cassette, like the headers and fields that are scrubbed.
+//
+// # Returns:
+//   - The Recorder.
+//   - An error if the cassette can't be read; in replay mode, a missing cassette is an error that matches
+//     os.ErrNotExist.
+func NewRecorder(cassettePath string, mode RecorderMode, options RecorderOptions) (*Recorder, error) {
+	r := &Recorder{
+		path:         cassettePath,
+		mode:         mode,
+		scrub:        make(map[string]bool),
+		scrubFields:  make(map[string]bool),
+		scrubBody:    options.ScrubBody,
+		maxBodySize:  options.MaxBodySize,
+		interactions: make([]*Interaction, 0),
+		replayed:     make(map[string]int),
+	}
+
+	if r.maxBodySize == 0 {
+		r.maxBodySize = DefaultMaxBodySize
+	}
+
+	for _, header := range append(slices.Clone(DefaultScrubbedHeaders), options.ScrubHeaders...) {
+		r.scrub[http.CanonicalHeaderKey(header)] = true
+	}
+
+	for _, field := range append(slices.Clone(DefaultScrubbedFields), options.ScrubFields...) {
+		r.scrubFields[field] = true
+	}
+
+	if mode == RecorderRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(cassettePath)
+	if err != nil {
+		if mode == RecorderAuto && os.IsNotExist(err) {
+			return r, nil
+		}
+
+		return nil, fmt.Errorf("could not read cassette: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("invalid cassette '%s': %w", cassettePath, err)
+	}
+
+	return r, nil
+}
+
+// Interactions returns the requests and responses in the cassette.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interactions := make([]Interaction, 0, len(r.interactions))
+	for _, interaction := range r.interactions {
+		interactions = append(interactions, *interaction)
+	}
+
+	return interactions
+}
+
+// region - Private functions
+
+// recorderTransport is a http.RoundTripper that sends the requests through the Recorder of the Fetch instance; without
+// a Recorder, the requests go straight to the base transport.
+type recorderTransport struct {
+	base  http.RoundTripper
+	fetch *Fetch
+}
+
+func (t *recorderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.fetch.recorder == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	return t.fetch.recorder.roundTrip(t.base, req)
+}
+
+func (r *Recorder) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("could not read request body: %w", err)
+		}
+
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recordedUrl, recordedBody := r.scrubRequest(req, body)
+	key := interactionKey(req.Method, recordedUrl, recordedBody, req.Header.Get("Range"))
+
+	if r.mode != RecorderRecord {
+		if interaction := r.find(key); interaction != nil {
+			return interaction.Response.response(req)
+		}
+
+		if r.mode == RecorderReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, truncated, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !truncated {
+		respBody = r.scrubJSON(respBody)
+	}
+
+	if r.scrubBody != nil {
+		respBody = r.scrubBody(req, respBody)
+	}
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Url:    recordedUrl,
+			Header: r.scrubHeader(req.Header),
+			Body:   recordedBody,
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.scrubHeader(resp.Header),
+			Truncated:  truncated,
+		},
+	}
+
+	if utf8.Valid(respBody) {
+		interaction.Response.Body = string(respBody)
+	} else {
+		interaction.Response.BodyBase64 = base64.StdEncoding.EncodeToString(respBody)
+	}
+
+	if err = r.add(key, interaction); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// readBody reads the body of the response to save it in the cassette, and replaces it with a new reader for the
+// caller. Bodies of media larger than the maximum size are not read whole: only their beginning is returned, with
+// truncated set to true, and the rest is streamed to the caller.
+func (r *Recorder) readBody(resp *http.Response) ([]byte, bool, error) {
+	head := resp.Body
+	if r.maxBodySize > 0 {
+		head = io.NopCloser(io.LimitReader(resp.Body, r.maxBodySize+1))
+	}
+
+	body, err := io.ReadAll(head)
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, err
+	}
+
+	if r.maxBodySize > 0 && int64(len(body)) > r.maxBodySize && !isTextContent(resp.Header) {
+		resp.Body = &struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+		return body[:r.maxBodySize], true, nil
+	}
+
+	rest, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+
+	body = append(body, rest...)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, false, nil
+}
+
+// scrubRequest returns the URL and the body of the request as they are saved in the cassette: the values of the
+// scrubbed fields are replaced in the query string and in form or JSON bodies, and then ScrubBody changes the body.
+func (r *Recorder) scrubRequest(req *http.Request, body []byte) (string, string) {
+	recordedUrl := *req.URL
+	recordedUrl.RawQuery = r.scrubQuery(recordedUrl.RawQuery)
+
+	if len(body) == 0 {
+		return recordedUrl.String(), ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		body = []byte(r.scrubQuery(string(body)))
+	} else {
+		body = r.scrubJSON(body)
+	}
+
+	if r.scrubBody != nil {
+		body = r.scrubBody(req, body)
+	}
+
+	return recordedUrl.String(), string(body)
+}
+
+// scrubQuery replaces the values of the scrubbed fields in a query string, or a form body; queries without them are
+// returned as they are.
+func (r *Recorder) scrubQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil || rawQuery == "" {
+		return rawQuery
+	}
+
+	changed := false
+	for key := range values {
+		if r.scrubFields[key] {
+			values[key] = []string{scrubbedValue}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return rawQuery
+	}
+
+	return values.Encode()
+}
+
+// scrubJSON replaces the values of the scrubbed fields in a JSON body; other bodies are returned as they are.
+func (r *Recorder) scrubJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document interface{}
+	if decoder.Decode(&document) != nil || !r.scrubValue(document) {
+		return body
+	}
+
+	scrubbed, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+
+	return scrubbed
+}
+
+// scrubValue replaces the values of the scrubbed fields in the JSON value, at any depth. It returns true if anything was
+// replaced.
+func (r *Recorder) scrubValue(value interface{}) bool {
+	changed := false
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if r.scrubFields[key] {
+				v[key] = scrubbedValue
+				changed = true
+			} else if r.scrubValue(field) {
+				changed = true
+			}
+		}
+
+	case []interface{}:
+		for _, item := range v {
+			if r.scrubValue(item) {
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// find returns the next recorded interaction of the request; when all were replayed, the last one is used again.
+func (r *Recorder) find(key string) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches := make([]*Interaction, 0)
+	for _, interaction := range r.interactions {
+		if interaction.key() == key {
+			matches = append(matches, interaction)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	index := min(r.replayed[key], len(matches)-1)
+	r.replayed[key]++
+
+	return matches[index]
+}
+
+// add adds the interaction to the cassette and saves it.
+func (r *Recorder) add(key string, interaction *Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.interactions = append(r.interactions, interaction)
+
+	// A recorded interaction counts as replayed, so it's not returned for the next identical request in auto mode
+	r.replayed[key]++
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode cassette: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	tmpPath := r.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("could not save cassette: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, r.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("could not save cassette: %w", err)
+	}
+
+	return nil
+}
+
+// scrubHeader returns a copy of the header, with the values of the scrubbed headers replaced.
+func (r *Recorder) scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for key := range scrubbed {
+		if r.scrub[http.CanonicalHeaderKey(key)] {
+			scrubbed[key] = []string{scrubbedValue}
+		}
+	}
+
+	return scrubbed
+}
+
+func (i *Interaction) key() string {
+	return interactionKey(i.Request.Method, i.Request.Url, i.Request.Body, i.Request.Header.Get("Range"))
+}
+
+// response creates a http.Response from the recorded one.
+func (rr *RecordedResponse) response(req *http.Request) (*http.Response, error) {
+	body := []byte(rr.Body)
+	if rr.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(rr.BodyBase64); err != nil {
+			return nil, fmt.Errorf("invalid body in cassette: %w", err)
+		}
+	}
+
+	header := rr.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	// The body is saved decompressed
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rr.StatusCode, http.StatusText(rr.StatusCode)),
+		StatusCode:    rr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// isTextContent checks if the Content-Type of the response is text, like HTML or JSON, which is never truncated.
+func isTextContent(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || strings.HasSuffix(mediaType, "javascript")
+}
+
+func interactionKey(method string, url string, body string, byteRange string) string {
+	return strings.Join([]string{strings.ToUpper(method), url, body, byteRange}, "\n")
+}
+
+// endregion
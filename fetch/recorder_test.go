@@ -0,0 +1,249 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(fmt.Sprintf("response %d", count.Add(1))))
+	}))
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewRecorder(cassette, RecorderRecord, RecorderOptions{})
+	assert.NoError(t, err)
+
+	fetch := New(map[string]string{"Authorization": "Bearer token"}, 0, WithRecorder(recorder))
+	first, _ := fetch.GetText(server.URL)
+	second, _ := fetch.GetText(server.URL)
+	server.Close()
+
+	assert.Equal(t, "response 1", first)
+	assert.Equal(t, "response 2", second)
+
+	// Tokens and cookies are not saved
+	data, _ := os.ReadFile(cassette)
+	assert.NotContains(t, string(data), "Bearer token")
+	assert.NotContains(t, string(data), "session=secret")
+
+	// The server is closed, so the responses can only come from the cassette, in the same order
+	recorder, err = NewRecorder(cassette, RecorderReplay, RecorderOptions{})
+	assert.NoError(t, err)
+
+	fetch = New(nil, 0, WithRecorder(recorder))
+	for _, expected := range []string{"response 1", "response 2", "response 2"} {
+		text, tErr := fetch.GetText(server.URL)
+		assert.NoError(t, tErr)
+		assert.Equal(t, expected, text)
+	}
+
+	_, err = fetch.GetText(server.URL + "/other")
+	assert.ErrorIs(t, err, ErrNotRecorded)
+}
+
+func TestRecorder_Download(t *testing.T) {
+	content := []byte("\x89PNG\r\n\x1a\n\xff\xfe binary")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+
+	dir := t.TempDir()
+	cassette := filepath.Join(dir, "cassette.json")
+	recorder, _ := NewRecorder(cassette, RecorderAuto, RecorderOptions{})
+
+	fetch := New(nil, 0, WithRecorder(recorder))
+	request, _ := fetch.NewRequest(server.URL+"/image.png", filepath.Join(dir, "recorded.png"))
+	assert.NoError(t, fetch.DownloadFile(request).Error())
+	server.Close()
+
+	recorder, _ = NewRecorder(cassette, RecorderReplay, RecorderOptions{})
+	assert.Len(t, recorder.Interactions(), 1)
+	assert.NotEmpty(t, recorder.Interactions()[0].Response.BodyBase64)
+
+	fetch = New(nil, 0, WithRecorder(recorder))
+	request, _ = fetch.NewRequest(server.URL+"/image.png", filepath.Join(dir, "replayed.png"))
+	assert.NoError(t, fetch.DownloadFile(request).Error())
+
+	data, _ := os.ReadFile(filepath.Join(dir, "replayed.png"))
+	assert.Equal(t, content, data)
+}
+
+func TestRecorder_ReplayCassette(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	os.WriteFile(cassette, []byte(`[{
+		"request": {"method": "GET", "url": "http://example.invalid/api"},
+		"response": {"statusCode": 200, "body": "{\"name\":\"umd\"}"}
+	}]`), 0644)
+
+	recorder, err := NewRecorder(cassette, RecorderReplay, RecorderOptions{})
+	assert.NoError(t, err)
+
+	fetch := New(nil, 0, WithRecorder(recorder))
+
+	var result struct{ Name string }
+	_, err = fetch.GetResult("http://example.invalid/api", nil, &result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "umd", result.Name)
+
+	_, err = NewRecorder(strings.TrimSuffix(cassette, ".json")+"-missing.json", RecorderReplay, RecorderOptions{})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRecorder_ScrubBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"secret-token","user":{"session":"secret-session","name":"umd"},"page":"api-key"}`))
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, _ := NewRecorder(cassette, RecorderRecord, RecorderOptions{
+		ScrubBody: func(_ *http.Request, body []byte) []byte {
+			return bytes.ReplaceAll(body, []byte("api-key"), []byte("[scrubbed]"))
+		},
+	})
+
+	// The caller gets the original body
+	fetch := New(nil, 0, WithRecorder(recorder))
+	text, err := fetch.GetText(server.URL)
+	assert.NoError(t, err)
+	assert.Contains(t, text, "secret-token")
+
+	data, _ := os.ReadFile(cassette)
+	assert.NotContains(t, string(data), "secret-token")
+	assert.NotContains(t, string(data), "secret-session")
+	assert.NotContains(t, string(data), "api-key")
+	assert.Contains(t, string(data), "umd")
+}
+
+func TestRecorder_ScrubRequest(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("response %d", count.Add(1))))
+	}))
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, _ := NewRecorder(cassette, RecorderRecord, RecorderOptions{ScrubFields: []string{"password"}})
+
+	fetch := New(nil, 0, WithRecorder(recorder))
+	_, err := fetch.GetText(server.URL + "/feed?page=2&token=query-token")
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: fetch.httpClient.Transport}
+	form := url.Values{"user": {"umd"}, "password": {"form-password"}}
+	resp, err := client.PostForm(server.URL+"/login", form)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = client.Post(server.URL+"/auth", "application/json",
+		strings.NewReader(`{"refresh_token":"json-token","user":"umd"}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	server.Close()
+
+	// Tokens sent in the query string and in the bodies are not saved
+	data, _ := os.ReadFile(cassette)
+	for _, secret := range []string{"query-token", "form-password", "json-token"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	// The requests are still matched when replayed, since they are scrubbed the same way
+	recorder, _ = NewRecorder(cassette, RecorderReplay, RecorderOptions{ScrubFields: []string{"password"}})
+	fetch = New(nil, 0, WithRecorder(recorder))
+
+	text, err := fetch.GetText(server.URL + "/feed?page=2&token=other-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "response 1", text)
+
+	client = &http.Client{Transport: fetch.httpClient.Transport}
+	resp, err = client.PostForm(server.URL+"/login", form)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "response 2", string(body))
+
+	resp, err = client.Post(server.URL+"/auth", "application/json",
+		strings.NewReader(`{"refresh_token":"json-token","user":"umd"}`))
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "response 3", string(body))
+}
+
+func TestRecorder_TruncateMedia(t *testing.T) {
+	content := bytes.Repeat([]byte{0xff, 0x00}, 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cassette := filepath.Join(dir, "cassette.json")
+	recorder, _ := NewRecorder(cassette, RecorderRecord, RecorderOptions{MaxBodySize: 100})
+
+	// The download gets the whole file, but only its beginning is saved
+	fetch := New(nil, 0, WithRecorder(recorder))
+	request, _ := fetch.NewRequest(server.URL+"/video.mp4", filepath.Join(dir, "video.mp4"))
+	assert.NoError(t, fetch.DownloadFile(request).Error())
+
+	data, _ := os.ReadFile(filepath.Join(dir, "video.mp4"))
+	assert.Equal(t, content, data)
+
+	response := recorder.Interactions()[0].Response
+	assert.True(t, response.Truncated)
+
+	body, _ := base64.StdEncoding.DecodeString(response.BodyBase64)
+	assert.Equal(t, content[:100], body)
+}
+
+func TestWithTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served to " + r.Host))
+	}))
+	defer server.Close()
+
+	// All requests go to the test server, no matter the host in the URL
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		target, _ := url.Parse(server.URL)
+		redirected := req.Clone(req.Context())
+		redirected.URL.Scheme, redirected.URL.Host, redirected.Host = target.Scheme, target.Host, req.URL.Host
+
+		return http.DefaultTransport.RoundTrip(redirected)
+	})
+
+	fetch := New(nil, 0, WithTransport(transport))
+	text, err := fetch.GetText("https://example.invalid/page")
+	assert.NoError(t, err)
+	assert.Equal(t, "served to example.invalid", text)
+
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	request, _ := fetch.NewRequest("https://example.invalid/file.txt", filePath)
+	assert.NoError(t, fetch.DownloadFile(request).Error())
+
+	// Other instances still use the network
+	_, err = New(nil, 0).GetText("https://example.invalid/page")
+	assert.Error(t, err)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
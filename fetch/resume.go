@@ -0,0 +1,111 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// resumeState holds the validators of a partially downloaded file. It is saved next to the file, so an interrupted
+// download can be safely resumed later, even after the process restarts.
+type resumeState struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+
+	// Segments is the progress of each segment, when the file is downloaded in segments.
+	Segments []segment `json:"segments,omitempty"`
+}
+
+// resumeStatePath returns the path of the file where the resume state of filePath is stored.
+func resumeStatePath(filePath string) string {
+	return filePath + ".resume"
+}
+
+// loadResumeState reads the resume state saved for filePath. It returns nil if there's no state or it can't be read.
+func loadResumeState(filePath string) *resumeState {
+	data, err := os.ReadFile(resumeStatePath(filePath))
+	if err != nil {
+		return nil
+	}
+
+	var state resumeState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+
+	return &state
+}
+
+// save writes the resume state next to filePath.
+func (s *resumeState) save(filePath string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("could not encode resume state: %w", err)
+	}
+
+	if err = os.WriteFile(resumeStatePath(filePath), data, 0o644); err != nil {
+		return fmt.Errorf("could not save resume state: %w", err)
+	}
+
+	return nil
+}
+
+// removeResumeState deletes the resume state of filePath, if it exists.
+func removeResumeState(filePath string) {
+	_ = os.Remove(resumeStatePath(filePath))
+}
+
+// canResume checks if the state belongs to the given URL and has at least one validator that can be sent to the server.
+func (s *resumeState) canResume(url string) bool {
+	return s != nil && s.Url == url && s.ifRange() != ""
+}
+
+// ifRange returns the value to be used in the If-Range header. Strong ETags are preferred; weak ETags can't be used
+// in If-Range, so in that case it falls back to Last-Modified.
+func (s *resumeState) ifRange() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+
+	return s.LastModified
+}
+
+// matches checks if the validators in the HTTP response are compatible with the ones saved in the state.
+func (s *resumeState) matches(resp *http.Response, total int64) bool {
+	if etag := resp.Header.Get("ETag"); s.ETag != "" && etag != "" && etag != s.ETag {
+		return false
+	}
+
+	if lm := resp.Header.Get("Last-Modified"); s.LastModified != "" && lm != "" && lm != s.LastModified {
+		return false
+	}
+
+	return s.Size <= 0 || total <= 0 || s.Size == total
+}
+
+// update refreshes the validators in the state with the ones found in the HTTP response.
+func (s *resumeState) update(resp *http.Response, total int64) {
+	s.ETag = resp.Header.Get("ETag")
+	s.LastModified = resp.Header.Get("Last-Modified")
+	s.Size = total
+}
+
+// parseContentRange extracts the total size from a Content-Range header, like "bytes 500-999/1234" or "bytes */1234".
+// It returns -1 if the total size is unknown.
+func parseContentRange(header string) int64 {
+	index := strings.LastIndex(header, "/")
+	if index == -1 {
+		return -1
+	}
+
+	var total int64
+	if _, err := fmt.Sscanf(header[index+1:], "%d", &total); err != nil {
+		return -1
+	}
+
+	return total
+}
@@ -0,0 +1,217 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRetryWait is the longest time we wait before a retry, unless changed with WithMaxRetryWait.
+const defaultMaxRetryWait = 2 * time.Minute
+
+// RetryPolicy decides if and when failed requests are retried. The same policy is used by GetText, GetResult and the
+// downloads.
+type RetryPolicy interface {
+	// MaxAttempts returns the maximum number of attempts, including the first one.
+	MaxAttempts() int
+
+	// Backoff returns how long to wait before a retry; the first retry is 1. It's not used when the server tells how
+	// long to wait, through headers like Retry-After.
+	Backoff(retry int) time.Duration
+
+	// MaxElapsedTime returns the maximum time spent on a request, including all retries; zero means no limit.
+	MaxElapsedTime() time.Duration
+
+	// ShouldRetry decides if a failed attempt can be retried. It receives the HTTP status of the attempt, or zero if no
+	// response was received, and the error of the attempt, if any.
+	ShouldRetry(statusCode int, err error) bool
+}
+
+// DefaultRetryPolicy is a RetryPolicy where the wait between retries follows the Fibonacci sequence (1, 1, 2, 3, 5...)
+// multiplied by BaseWait, with some random jitter.
+type DefaultRetryPolicy struct {
+	// Retries is the number of retries after the first attempt.
+	Retries int
+
+	// BaseWait is multiplied by the Fibonacci sequence to get the wait before each retry.
+	BaseWait time.Duration
+
+	// Jitter is the fraction, between 0 and 1, by which each wait can randomly vary. For example, 0.2 means that a wait
+	// of 10s can be anything between 8s and 12s.
+	Jitter float64
+
+	// MaxElapsed is the maximum time spent on a request, including all retries; zero means no limit.
+	MaxElapsed time.Duration
+
+	// NonRetryableStatuses are the HTTP statuses that are never retried.
+	NonRetryableStatuses []int
+}
+
+// NewDefaultRetryPolicy creates a DefaultRetryPolicy with the given number of retries. The waits start at 1 second,
+// with a jitter of 20%, and HTTP 404 and 410 are not retried, because we know the resource is not there.
+func NewDefaultRetryPolicy(retries int) *DefaultRetryPolicy {
+	return &DefaultRetryPolicy{
+		Retries:              retries,
+		BaseWait:             time.Second,
+		Jitter:               0.2,
+		NonRetryableStatuses: []int{http.StatusNotFound, http.StatusGone},
+	}
+}
+
+func (p *DefaultRetryPolicy) MaxAttempts() int {
+	return max(p.Retries, 0) + 1
+}
+
+func (p *DefaultRetryPolicy) Backoff(retry int) time.Duration {
+	wait := time.Duration(fibonacci(retry+1)) * p.BaseWait
+	if p.Jitter > 0 {
+		wait = time.Duration(float64(wait) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+
+	return wait
+}
+
+func (p *DefaultRetryPolicy) MaxElapsedTime() time.Duration {
+	return p.MaxElapsed
+}
+
+func (p *DefaultRetryPolicy) ShouldRetry(statusCode int, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	return !slices.Contains(p.NonRetryableStatuses, statusCode)
+}
+
+// Compile-time assertion to ensure the policy implements the RetryPolicy interface
+var _ RetryPolicy = (*DefaultRetryPolicy)(nil)
+
+// RetryEvent describes a failed attempt that is about to be retried.
+type RetryEvent struct {
+	// Url is the URL of the request.
+	Url string
+
+	// Attempt is the number of the attempt that failed, starting at 1.
+	Attempt int
+
+	// StatusCode is the HTTP status of the failed attempt, or zero if no response was received.
+	StatusCode int
+
+	// Err is the error of the failed attempt, if any.
+	Err error
+
+	// Wait is how long we wait before the next attempt.
+	Wait time.Duration
+
+	// RateLimited is true when the wait was requested by the server, through headers like Retry-After.
+	RateLimited bool
+}
+
+// retryStartKey is the context key where the start time of a REST request is saved, to enforce the maximum elapsed
+// time of the retry policy.
+type retryStartKey struct{}
+
+// region - Private methods
+
+// retryWait returns how long to wait before retrying a failed attempt. The wait requested by the server is used when
+// the response is rate limited; otherwise the wait grows with the number of attempts. Either way, it's capped by the
+// maximum retry wait.
+func (f *Fetch) retryWait(attempt int, resp *http.Response) (time.Duration, bool) {
+	wait, limited := rateLimitWait(resp)
+	if !limited {
+		wait = f.retryPolicy.Backoff(attempt)
+	}
+
+	return min(wait, f.maxRetryWait), limited
+}
+
+// canRetry checks if the retry policy allows another attempt, after waiting for the given time.
+func (f *Fetch) canRetry(attempt int, start time.Time, wait time.Duration, statusCode int, err error) bool {
+	if attempt >= f.retryPolicy.MaxAttempts() || !f.retryPolicy.ShouldRetry(statusCode, err) {
+		return false
+	}
+
+	maxElapsed := f.retryPolicy.MaxElapsedTime()
+	return maxElapsed <= 0 || time.Since(start)+wait <= maxElapsed
+}
+
+func (f *Fetch) notifyRetry(event RetryEvent) {
+	if f.retryObserver != nil {
+		f.retryObserver(event)
+	}
+}
+
+// endregion
+
+// region - Private functions
+
+func withRetryStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryStartKey{}, time.Now())
+}
+
+// rateLimitWait checks if the response was rate limited and returns how long the server wants us to wait. It
+// recognises the headers Retry-After, RateLimit-Reset and X-Ratelimit-Reset (used by Reddit).
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" &&
+		(resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return max(time.Until(date), 0), true
+		}
+	}
+
+	// The reset headers are only meaningful when the quota is exhausted
+	remaining := resp.Header.Get("X-Ratelimit-Remaining")
+	exhausted := resp.StatusCode == http.StatusTooManyRequests
+	if value, err := strconv.ParseFloat(remaining, 64); err == nil && value < 1 {
+		exhausted = true
+	}
+
+	if !exhausted {
+		return 0, false
+	}
+
+	for _, header := range []string{"X-Ratelimit-Reset", "RateLimit-Reset"} {
+		if value := resp.Header.Get(header); value != "" {
+			if seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && seconds >= 0 {
+				return time.Duration(seconds * float64(time.Second)), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for the duration, returning earlier with an error if the context is canceled.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func fibonacci(n int) int {
+	if n <= 1 {
+		return n
+	}
+	return fibonacci(n-1) + fibonacci(n-2)
+}
+
+// endregion
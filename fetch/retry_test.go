@@ -0,0 +1,206 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch_GetText_RetryAfter(t *testing.T) {
+	var attempts int32
+	events := make([]RetryEvent, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "100")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Hello, World!"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 3,
+		WithMaxRetryWait(200*time.Millisecond),
+		WithRetryObserver(func(event RetryEvent) { events = append(events, event) }),
+	)
+
+	start := time.Now()
+	body, err := fetch.GetText(server.URL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", body)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, events, 1)
+	assert.Equal(t, http.StatusTooManyRequests, events[0].StatusCode)
+	assert.Equal(t, 200*time.Millisecond, events[0].Wait)
+	assert.True(t, events[0].RateLimited)
+}
+
+func TestFetch_GetTextContext_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	fetch := New(nil, 3)
+
+	start := time.Now()
+	_, err := fetch.GetTextContext(ctx, server.URL)
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFetch_DownloadFile_RateLimitReset(t *testing.T) {
+	var attempts int32
+	events := make([]RetryEvent, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("X-Ratelimit-Remaining", "0.0")
+			w.Header().Set("X-Ratelimit-Reset", "0.1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("file content"))
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 3, WithRetryObserver(func(event RetryEvent) { events = append(events, event) }))
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, events, 1)
+	assert.Equal(t, 100*time.Millisecond, events[0].Wait)
+	assert.True(t, events[0].RateLimited)
+}
+
+func TestFetch_DownloadFile_CancelWhileWaiting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 3)
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	time.AfterFunc(200*time.Millisecond, resp.Cancel)
+
+	start := time.Now()
+	assert.ErrorIs(t, resp.Error(), context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRateLimitWait_RetryAfterDate(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	resp.Header.Set("Retry-After", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+
+	wait, limited := rateLimitWait(resp)
+
+	assert.True(t, limited)
+	assert.InDelta(t, 10*time.Second, wait, float64(2*time.Second))
+}
+
+func TestFetch_RetryPolicy_NotFound(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 3)
+	_, err := fetch.GetText(server.URL)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.ErrorContains(t, resp.Error(), "unexpected status: 404")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestFetch_RetryPolicy_MaxElapsed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+
+	policy := NewDefaultRetryPolicy(10)
+	policy.MaxElapsed = 500 * time.Millisecond
+	fetch := New(nil, 0, WithRetryPolicy(policy))
+
+	start := time.Now()
+	_, err := fetch.GetText(server.URL)
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	start = time.Now()
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.Error(t, resp.Error())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+// onlyUnavailable is a RetryPolicy that retries HTTP 503 immediately, at most twice.
+type onlyUnavailable struct{}
+
+func (onlyUnavailable) MaxAttempts() int              { return 3 }
+func (onlyUnavailable) Backoff(int) time.Duration     { return 0 }
+func (onlyUnavailable) MaxElapsedTime() time.Duration { return 0 }
+func (onlyUnavailable) ShouldRetry(status int, _ error) bool {
+	return status == http.StatusServiceUnavailable
+}
+
+func TestFetch_RetryPolicy_Custom(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	defer server.Close()
+
+	fetch := New(nil, 0, WithRetryPolicy(onlyUnavailable{}))
+	_, err := fetch.GetText(server.URL)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	request, _ := fetch.NewRequest(server.URL, filepath.Join(t.TempDir(), "testfile.txt"))
+	resp := fetch.DownloadFile(request)
+
+	assert.Error(t, resp.Error())
+	assert.Equal(t, int32(6), atomic.LoadInt32(&attempts))
+}
@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNameLength is the maximum length, in bytes, of a file or directory name. Most file systems accept up to 255
+// bytes, but we leave room for the suffixes added to resolve collisions and to save the state of partial downloads.
+const maxNameLength = 200
+
+// windowsReserved are names that can't be used by files in Windows, with or without extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true,
+	"COM9": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true,
+	"LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName makes a file or directory name valid in Linux, Windows and macOS. Invalid characters are replaced
+// by an underscore, reserved names are prefixed with an underscore, and long names are truncated, keeping the
+// extension.
+//
+// # Parameters:
+//   - name: the name of a file or directory, without any path separator.
+//
+// # Returns:
+//   - The sanitized name; it's never empty.
+func SanitizeFileName(name string) string {
+	var builder strings.Builder
+
+	for _, r := range name {
+		switch {
+		case r < 32 || r == 127:
+			builder.WriteRune('_')
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			builder.WriteRune('_')
+		case r == utf8.RuneError:
+			builder.WriteRune('_')
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	// Windows doesn't allow names ending with dots or spaces
+	sanitized := strings.TrimRight(strings.TrimSpace(builder.String()), ". ")
+
+	if sanitized == "" {
+		return "_"
+	}
+
+	// Windows reserves the name with any extension, even multiple ones like "CON.tar.gz"
+	stem, _, _ := strings.Cut(sanitized, ".")
+	if windowsReserved[strings.ToUpper(stem)] {
+		sanitized = "_" + sanitized
+	}
+
+	return truncateName(sanitized, maxNameLength)
+}
+
+// region - Private functions
+
+// truncateName shortens the name to have at most maxBytes, without breaking multibyte characters and keeping the
+// extension, as long as the extension itself is not too long. The name is never left without a stem, like ".jpg".
+func truncateName(name string, maxBytes int) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) >= maxBytes/2 {
+		ext = ""
+	}
+
+	stem := strings.TrimSuffix(name, ext)
+	limit := maxBytes - len(ext)
+
+	// Move back until we find the beginning of a character
+	for limit > 0 && !utf8.RuneStart(stem[limit]) {
+		limit--
+	}
+
+	stem = strings.TrimRight(stem[:limit], ". ")
+	if stem == "" {
+		stem = "_"
+	}
+
+	return stem + ext
+}
+
+// endregion
@@ -0,0 +1,374 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// defaultMinSegmentedSize is the smallest file, in bytes, downloaded in segments when no size is set in WithSegments.
+const defaultMinSegmentedSize = 16 << 20
+
+// errRemoteChanged means that the remote file changed while its segments were downloaded.
+var errRemoteChanged = errors.New("remote file changed")
+
+// segment is a range of bytes of a file, downloaded by its own connection.
+type segment struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Written int64 `json:"written"`
+}
+
+// remaining returns how many bytes of the segment were not downloaded yet.
+func (s *segment) remaining() int64 {
+	return s.End - s.Start + 1 - s.Written
+}
+
+// region - Private functions
+
+// segmentCount returns in how many segments the request must be downloaded; 1 means a single stream.
+func (f *Fetch) segmentCount(request *Request) int {
+	if request.Segments > 0 {
+		return request.Segments
+	}
+
+	return max(f.segments, 1)
+}
+
+// splitSegments splits the file into segments of roughly the same size.
+func splitSegments(total int64, count int) []segment {
+	count = int(min(int64(count), total))
+	segments := make([]segment, 0, count)
+
+	size := total / int64(count)
+	for i := 0; i < count; i++ {
+		start := int64(i) * size
+		end := start + size - 1
+		if i == count-1 {
+			end = total - 1
+		}
+
+		segments = append(segments, segment{Start: start, End: end})
+	}
+
+	return segments
+}
+
+// downloadSegmented downloads the file in segments, in parallel, into a preallocated file. Each segment is retried on
+// its own, and the progress of the segments is saved in the resume state, so the download can be resumed later.
+//
+// It returns false when the file must be downloaded in a single stream instead, because the server doesn't support
+// ranges, the file has no validators or is too small, or the remote file changed during the download.
+func (f *Fetch) downloadSegmented(
+	response *Response,
+	count int,
+	state *resumeState,
+	expected *checksum,
+	file *os.File,
+	ctx context.Context,
+) bool {
+	probe, total, err := f.probeRanges(ctx, response)
+	if err != nil {
+		if ctx.Err() != nil {
+			response.err = ctx.Err()
+			return true
+		}
+
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   response.Request.Url,
+		}).Debug("can't download file in segments; using a single connection")
+
+		return false
+	}
+
+	// Segments saved by a previous attempt are only reused if the remote file didn't change
+	if len(state.Segments) == 0 || !state.matches(probe, total) {
+		if total < f.minSegmentedSize {
+			return false
+		}
+
+		*state = resumeState{Url: response.Request.Url, Segments: splitSegments(total, count)}
+		state.update(probe, total)
+		if state.ifRange() == "" {
+			return false
+		}
+
+		if err = file.Truncate(0); err == nil {
+			err = file.Truncate(total)
+		}
+
+		if err != nil {
+			response.err = fmt.Errorf("could not preallocate file: %w", err)
+			return true
+		}
+	}
+
+	saver := &stateSaver{state: state, response: response}
+	saver.save()
+
+	response.size.Store(total)
+	for _, s := range state.Segments {
+		response.downloaded.Add(s.Written)
+	}
+
+	segmentCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(state.Segments))
+
+	for i := range state.Segments {
+		s := &state.Segments[i]
+		if s.remaining() <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if sErr := f.downloadSegment(segmentCtx, response, state, s, file, saver); sErr != nil {
+				errs[i] = sErr
+				cancel()
+			}
+
+			saver.save()
+		}()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		response.err = ctx.Err()
+		return true
+	}
+
+	for _, sErr := range errs {
+		if errors.Is(sErr, errRemoteChanged) {
+			log.WithFields(log.Fields{
+				"url": response.Request.Url,
+			}).Warn("remote file changed during the download; downloading it again")
+
+			return false
+		}
+	}
+
+	for _, sErr := range errs {
+		if sErr != nil && !errors.Is(sErr, context.Canceled) {
+			response.err = sErr
+			return true
+		}
+	}
+
+	// A corrupted file is downloaded again, in a single stream
+	if vErr := f.verifyDownload(response, expected, nil, nil); vErr != nil {
+		response.err = vErr
+		return false
+	}
+
+	response.StatusCode = http.StatusPartialContent
+	response.err = nil
+	removeResumeState(response.FilePath)
+
+	return true
+}
+
+// probeRanges requests the first byte of the file, to find out if the server supports ranges and the size of the file.
+func (f *Fetch) probeRanges(ctx context.Context, response *Response) (*http.Response, int64, error) {
+	req := response.Request.httpReq.Clone(ctx)
+	req.Header.Set("Range", "bytes=0-0")
+	req.Header.Del("If-Range")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request error: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Accept-Ranges") == "none" {
+		return nil, 0, fmt.Errorf("ranges not supported: status %d", resp.StatusCode)
+	}
+
+	total := parseContentRange(resp.Header.Get("Content-Range"))
+	if total <= 0 {
+		return nil, 0, fmt.Errorf("unknown file size")
+	}
+
+	return resp, total, nil
+}
+
+// downloadSegment downloads the remaining bytes of a segment, retrying it according to the retry policy.
+func (f *Fetch) downloadSegment(
+	ctx context.Context,
+	response *Response,
+	state *resumeState,
+	s *segment,
+	file *os.File,
+	saver *stateSaver,
+) error {
+	var resp *http.Response
+	var err error
+
+	start := time.Now()
+	writer := &segmentWriter{file: file, segment: s, saver: saver}
+
+	for attempt := 0; attempt < f.retryPolicy.MaxAttempts(); attempt++ {
+		if attempt > 0 {
+			backoff, limited := f.retryWait(attempt, resp)
+
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+
+			if !f.canRetry(attempt, start, backoff, statusCode, err) {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"attempt": attempt,
+				"error":   err,
+				"range":   fmt.Sprintf("%d-%d", s.Start, s.End),
+				"url":     response.Request.Url,
+			}).Warn("failed to download segment; retrying in ", backoff)
+
+			f.notifyRetry(RetryEvent{
+				Url:         response.Request.Url,
+				Attempt:     attempt,
+				StatusCode:  statusCode,
+				Err:         err,
+				Wait:        backoff,
+				RateLimited: limited,
+			})
+
+			if sErr := sleepContext(ctx, backoff); sErr != nil {
+				return sErr
+			}
+		}
+
+		req := response.Request.httpReq.Clone(ctx)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", s.Start+s.Written, s.End))
+		req.Header.Set("If-Range", state.ifRange())
+
+		resp, err = f.httpClient.Do(req)
+		if err != nil {
+			err = fmt.Errorf("request error: %w", err)
+			continue
+		}
+
+		// The server sends the whole file when the If-Range validator doesn't match anymore
+		if resp.StatusCode == http.StatusOK {
+			resp.Body.Close()
+			return errRemoteChanged
+		}
+
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected status: %d", resp.StatusCode)
+			continue
+		}
+
+		if !state.matches(resp, parseContentRange(resp.Header.Get("Content-Range"))) {
+			resp.Body.Close()
+			return errRemoteChanged
+		}
+
+		body := &throttledReader{
+			ctx:      ctx,
+			reader:   io.LimitReader(resp.Body, s.remaining()),
+			limiters: []*rate.Limiter{f.bandwidth, response.bandwidth},
+		}
+
+		_, err = io.Copy(writer, body)
+		resp.Body.Close()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err = fmt.Errorf("segment interrupted: %w", err)
+			continue
+		}
+
+		if s.remaining() > 0 {
+			err = fmt.Errorf("segment interrupted: %d bytes missing", s.remaining())
+			continue
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+// resumeSaveInterval is the minimum time between two saves of the resume state while the segments are downloaded.
+var resumeSaveInterval = time.Second
+
+// stateSaver keeps track of the progress of the segments and saves it in the resume state, at most once every
+// resumeSaveInterval while the data is written, so a crash in the middle of a large segment loses little progress.
+type stateSaver struct {
+	mu       sync.Mutex
+	state    *resumeState
+	response *Response
+	lastSave time.Time
+}
+
+// save saves the resume state right away.
+func (s *stateSaver) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveLocked()
+}
+
+// add records n bytes written to the segment, saving the resume state if the last save is old enough.
+func (s *stateSaver) add(seg *segment, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg.Written += n
+	s.response.addDownloaded(n)
+
+	if time.Since(s.lastSave) >= resumeSaveInterval {
+		s.saveLocked()
+	}
+}
+
+func (s *stateSaver) saveLocked() {
+	s.lastSave = time.Now()
+
+	if err := s.state.save(s.response.FilePath); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   s.response.Request.Url,
+		}).Warn("failed to save resume state")
+	}
+}
+
+// segmentWriter writes the data of a segment at its position in the file, keeping track of the progress.
+type segmentWriter struct {
+	file    *os.File
+	segment *segment
+	saver   *stateSaver
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.segment.Start+w.segment.Written)
+	w.saver.add(w.segment, int64(n))
+
+	return n, err
+}
+
+// endregion
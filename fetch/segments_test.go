@@ -0,0 +1,222 @@
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRangeServer serves the content with support for ranges, recording the Range header of each request.
+func newRangeServer(content []byte, ranges *[]string) *httptest.Server {
+	var mu sync.Mutex
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+	}))
+}
+
+func TestFetch_DownloadFile_Segments(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	ranges := make([]string, 0)
+	server := newRangeServer(content, &ranges)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0, WithSegments(4, 1024))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, int64(len(content)), resp.Stats().Downloaded)
+	assert.Equal(t, 1.0, resp.Stats().Progress)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, content, data)
+	assert.ElementsMatch(t, []string{"bytes=0-0", "bytes=0-2499", "bytes=2500-4999", "bytes=5000-7499",
+		"bytes=7500-9999"}, ranges)
+	assert.NoFileExists(t, resumeStatePath(filePath))
+}
+
+func TestFetch_DownloadFile_SegmentsNoRanges(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0, WithSegments(4, 1024))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, content, data)
+}
+
+func TestFetch_DownloadFile_SegmentsSmallFile(t *testing.T) {
+	ranges := make([]string, 0)
+	server := newRangeServer([]byte("small file"), &ranges)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0, WithSegments(4, 1024))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"bytes=0-0", ""}, ranges)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, "small file", string(data))
+}
+
+func TestFetch_DownloadFile_SegmentRetry(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	failed := false
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The second segment fails once
+		if r.Header.Get("Range") == "bytes=2500-4999" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	retries := 0
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0,
+		WithSegments(4, 1024),
+		WithRetryPolicy(&DefaultRetryPolicy{Retries: 2, BaseWait: time.Millisecond}),
+		WithRetryObserver(func(RetryEvent) { retries++ }),
+	)
+
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.True(t, failed)
+	assert.Equal(t, 1, retries)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, content, data)
+}
+
+func TestFetch_DownloadFile_SegmentsResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	ranges := make([]string, 0)
+	server := newRangeServer(content, &ranges)
+	defer server.Close()
+
+	// The first 2 segments were downloaded by a previous attempt
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	partial := make([]byte, len(content))
+	copy(partial, content[:5000])
+	os.WriteFile(filePath, partial, 0644)
+
+	state := &resumeState{
+		Url:          server.URL,
+		ETag:         `"v1"`,
+		LastModified: "Mon, 01 Jan 2024 00:00:00 GMT",
+		Size:         int64(len(content)),
+		Segments:     splitSegments(int64(len(content)), 4),
+	}
+
+	state.Segments[0].Written = 2500
+	state.Segments[1].Written = 2500
+	state.save(filePath)
+
+	fetch := New(nil, 0, WithSegments(4, 1024))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	assert.NoError(t, resp.Error())
+	assert.ElementsMatch(t, []string{"bytes=0-0", "bytes=5000-7499", "bytes=7500-9999"}, ranges)
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, content, data)
+}
+
+func TestFetch_DownloadFile_SegmentsSaveProgress(t *testing.T) {
+	resumeSaveInterval = 0
+	defer func() { resumeSaveInterval = time.Second }()
+
+	content := []byte(strings.Repeat("0123456789", 1000))
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") == "bytes=0-0" {
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			return
+		}
+
+		// Each segment sends half of its bytes and stalls
+		var start, end int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : start+(end-start+1)/2])
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	fetch := New(nil, 0, WithSegments(4, 1024))
+	request, _ := fetch.NewRequest(server.URL, filePath)
+	resp := fetch.DownloadFile(request)
+
+	// The progress in the middle of the segments is saved before they finish
+	assert.Eventually(t, func() bool {
+		state := loadResumeState(filePath)
+		if state == nil || len(state.Segments) != 4 {
+			return false
+		}
+
+		for _, s := range state.Segments {
+			if s.Written != 1250 {
+				return false
+			}
+		}
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp.Cancel()
+	assert.Error(t, resp.Error())
+}
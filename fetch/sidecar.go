@@ -0,0 +1,301 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SidecarSuffix is added to the path of a downloaded file to get the path of its sidecar, like "photo.jpg.json".
+const SidecarSuffix = ".json"
+
+// ManifestName is the name of the manifest created in each directory by SidecarProcessor, when enabled.
+const ManifestName = "manifest.jsonl"
+
+// Sidecar has the provenance of a downloaded file: where it came from and what it is. It's saved by SidecarProcessor
+// next to the file, and can be read with ReadSidecar.
+type Sidecar struct {
+	// File is the name of the downloaded file, without the directory.
+	File string `json:"file"`
+
+	// Url is the URL of the media; DownloadUrl is only set when the file was downloaded from another one, like a
+	// mirror.
+	Url         string `json:"url"`
+	DownloadUrl string `json:"downloadUrl,omitempty"`
+
+	// Extractor is the name of the extractor that found the media, like "Reddit".
+	Extractor string `json:"extractor,omitempty"`
+
+	// Source is the type of source where the media was found, like "user" or "subreddit".
+	Source string `json:"source,omitempty"`
+
+	// Author is the name of the user or model that published the media.
+	Author string `json:"author,omitempty"`
+
+	// PostId is the ID of the post, or gif, where the media was published.
+	PostId string `json:"postId,omitempty"`
+
+	// Created is the time when the media was published; it's empty when the extractor doesn't know it, or only has a
+	// synthetic time.
+	Created *time.Time `json:"created,omitempty"`
+
+	// Page is the URL of the page where the media was published, like a Reddit submission.
+	Page string `json:"page,omitempty"`
+
+	// Size and Hash describe the downloaded file; the hash has the format "<algorithm>:<hex value>".
+	Size int64  `json:"size"`
+	Hash string `json:"hash,omitempty"`
+
+	// DownloadedAt is the time when the download completed.
+	DownloadedAt time.Time `json:"downloadedAt"`
+
+	// Metadata is all the metadata of the media, as returned by the extractor.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SidecarOptions configures the files written by SidecarProcessor.
+type SidecarOptions struct {
+	// Manifest, if true, also keeps the sidecars of all files of a directory in a single file, ManifestName, with one
+	// JSON object per line. A file downloaded again replaces its line.
+	Manifest bool
+}
+
+// SidecarProcessor returns a PostProcessor that saves the provenance of each downloaded file in a sidecar, in the same
+// path of the file with SidecarSuffix, from the Media used to create the request; see Fetch.NewMediaRequests. Files
+// without a media only have the URL, size and hash. Files skipped because they already exist keep their sidecar. The
+// sidecars, and the manifests, are replaced atomically, so they are never left half written.
+//
+// # Parameters:
+//   - options: the options of the sidecars.
+func SidecarProcessor(options SidecarOptions) PostProcessor {
+	return func(_ context.Context, response *Response) error {
+		// A skipped file was already downloaded, so its sidecar, if there's one, still has when and where it came from
+		if response.Skipped {
+			if _, err := os.Stat(response.FilePath + SidecarSuffix); err == nil {
+				return nil
+			}
+		}
+
+		sidecar := newSidecar(response)
+
+		data, err := json.MarshalIndent(sidecar, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode sidecar: %w", err)
+		}
+
+		if err = writeFileAtomic(response.FilePath+SidecarSuffix, data); err != nil {
+			return fmt.Errorf("could not save sidecar: %w", err)
+		}
+
+		if !options.Manifest {
+			return nil
+		}
+
+		manifestMu.Lock()
+		defer manifestMu.Unlock()
+
+		if err = updateManifest(filepath.Dir(response.FilePath), sidecar, ""); err != nil {
+			return fmt.Errorf("could not update manifest: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// ReadSidecar reads the sidecar of a downloaded file.
+//
+// # Parameters:
+//   - filePath: the path of the downloaded file, not of the sidecar.
+//
+// # Returns:
+//   - The Sidecar.
+//   - An error if the sidecar doesn't exist or is invalid.
+func ReadSidecar(filePath string) (*Sidecar, error) {
+	data, err := os.ReadFile(filePath + SidecarSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sidecar: %w", err)
+	}
+
+	var sidecar Sidecar
+	if err = json.Unmarshal(data, &sidecar); err != nil {
+		return nil, fmt.Errorf("invalid sidecar '%s': %w", filePath+SidecarSuffix, err)
+	}
+
+	return &sidecar, nil
+}
+
+// region - Private functions
+
+// manifestMu makes the manifests of all directories be updated one at a time, so concurrent downloads don't lose lines.
+var manifestMu sync.Mutex
+
+func newSidecar(response *Response) *Sidecar {
+	request := response.Request
+	sidecar := &Sidecar{
+		File:         filepath.Base(response.FilePath),
+		Url:          request.Url,
+		Size:         response.Stats().Size,
+		Hash:         response.Hash,
+		DownloadedAt: time.Now().UTC(),
+	}
+
+	if downloadUrl := request.httpReq.URL.String(); downloadUrl != request.Url {
+		sidecar.DownloadUrl = downloadUrl
+	}
+
+	if request.Media == nil {
+		return sidecar
+	}
+
+	media := request.Media
+	sidecar.Url = media.Url
+	sidecar.Extractor = media.Extractor.String()
+	sidecar.Metadata = media.Metadata
+	sidecar.Source = metadataString(media.Metadata, "source")
+	sidecar.Author = metadataString(media.Metadata, "name")
+	sidecar.PostId = metadataString(media.Metadata, "id")
+	sidecar.Page = metadataString(media.Metadata, "page")
+
+	if created, ok := mediaCreated(media.Metadata); ok {
+		created = created.UTC()
+		sidecar.Created = &created
+	}
+
+	return sidecar
+}
+
+// updateManifest replaces the line of the sidecar's file in the manifest of the directory, or adds it. The line of
+// oldFile, if not empty, is removed too.
+func updateManifest(directory string, sidecar *Sidecar, oldFile string) error {
+	manifestPath := filepath.Join(directory, ManifestName)
+	var buffer bytes.Buffer
+
+	if file, err := os.Open(manifestPath); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+		for scanner.Scan() {
+			var entry struct {
+				File string `json:"file"`
+			}
+
+			// Lines that can't be read are kept as they are
+			line := scanner.Bytes()
+			if json.Unmarshal(line, &entry) == nil && (entry.File == sidecar.File || entry.File == oldFile) {
+				continue
+			}
+
+			buffer.Write(line)
+			buffer.WriteByte('\n')
+		}
+
+		file.Close()
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	line, err := json.Marshal(sidecar)
+	if err != nil {
+		return err
+	}
+
+	buffer.Write(line)
+	buffer.WriteByte('\n')
+
+	return writeFileAtomic(manifestPath, buffer.Bytes())
+}
+
+// moveSidecar moves the sidecar of a file that was renamed, and its line in the manifest of the directory, if they
+// exist; a leftover resume state is moved too.
+func moveSidecar(oldPath string, newPath string) error {
+	if fileExists(resumeStatePath(oldPath)) {
+		if err := os.Rename(resumeStatePath(oldPath), resumeStatePath(newPath)); err != nil {
+			return err
+		}
+	}
+
+	sidecar, err := ReadSidecar(oldPath)
+	if err != nil {
+		if fileExists(oldPath + SidecarSuffix) {
+			return err
+		}
+
+		return nil
+	}
+
+	sidecar.File = filepath.Base(newPath)
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(newPath+SidecarSuffix, data); err != nil {
+		return err
+	}
+
+	if err = os.Remove(oldPath + SidecarSuffix); err != nil {
+		return err
+	}
+
+	directory := filepath.Dir(newPath)
+	if !fileExists(filepath.Join(directory, ManifestName)) {
+		return nil
+	}
+
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	return updateManifest(directory, sidecar, filepath.Base(oldPath))
+}
+
+// writeFileAtomic writes the data to a temporary file and renames it to the path, so readers never see a partial file.
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmp.Name()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Chmod(tmpPath, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+func metadataString(metadata map[string]interface{}, key string) string {
+	value, exists := metadata[key]
+	if !exists || value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
+
+// endregion
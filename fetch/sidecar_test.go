@@ -0,0 +1,135 @@
+package fetch
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+func TestSidecarProcessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image content"))
+	}))
+	defer server.Close()
+
+	created := time.Date(2020, time.May, 17, 10, 30, 0, 0, time.UTC)
+	media := model.NewMedia(server.URL+"/image.jpg", model.Reddit, map[string]interface{}{
+		"source":  "subreddit",
+		"name":    "someone",
+		"id":      "abc123",
+		"created": created,
+		"page":    "https://www.reddit.com/r/pics/comments/abc123/title/",
+	})
+
+	dir := t.TempDir()
+	fetch := New(nil, 0, WithPostProcessors(SidecarProcessor(SidecarOptions{})))
+	template, _ := ParsePathTemplate("{name}/{filename}.{ext}")
+	requests, _ := fetch.NewMediaRequests([]model.Media{media}, dir, template)
+	assert.NoError(t, fetch.DownloadFile(requests[0]).Error())
+
+	sidecar, err := ReadSidecar(requests[0].FilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "image.jpg", sidecar.File)
+	assert.Equal(t, server.URL+"/image.jpg", sidecar.Url)
+	assert.Equal(t, "Reddit", sidecar.Extractor)
+	assert.Equal(t, "subreddit", sidecar.Source)
+	assert.Equal(t, "someone", sidecar.Author)
+	assert.Equal(t, "abc123", sidecar.PostId)
+	assert.Equal(t, created, *sidecar.Created)
+	assert.Equal(t, "https://www.reddit.com/r/pics/comments/abc123/title/", sidecar.Page)
+	assert.Equal(t, int64(len("image content")), sidecar.Size)
+	assert.NotEmpty(t, sidecar.Hash)
+
+	// There's no manifest, nor temporary files left behind
+	files, _ := os.ReadDir(filepath.Join(dir, "someone"))
+	assert.Len(t, files, 2)
+}
+
+func TestSidecarProcessor_Manifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 0,
+		WithExistingFilePolicy(ExistingFileOverwrite),
+		WithPostProcessors(SidecarProcessor(SidecarOptions{Manifest: true})),
+	)
+
+	urls := []string{"/a.jpg", "/b.jpg", "/c.jpg", "/a.jpg"}
+	for _, url := range urls {
+		request, _ := fetch.NewRequest(server.URL+url, filepath.Join(dir, filepath.Base(url)))
+		assert.NoError(t, fetch.DownloadFile(request).Error())
+	}
+
+	file, err := os.Open(filepath.Join(dir, ManifestName))
+	assert.NoError(t, err)
+	defer file.Close()
+
+	// The file downloaded twice has a single line, at the end
+	names := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sidecar Sidecar
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &sidecar))
+		names = append(names, sidecar.File)
+	}
+
+	assert.Equal(t, []string{"b.jpg", "c.jpg", "a.jpg"}, names)
+}
+
+func TestSidecarProcessor_Skipped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image content"))
+	}))
+	defer server.Close()
+
+	// Fapello doesn't know when the media was published, so its created time is synthetic
+	media := model.NewMedia(server.URL+"/image.jpg", model.Fapello, map[string]interface{}{
+		"name":              "someone",
+		"created":           time.Date(1984, time.October, 6, 17, 7, 0, 0, time.UTC),
+		"created_synthetic": true,
+	})
+
+	dir := t.TempDir()
+	fetch := New(nil, 0,
+		WithExistingFilePolicy(ExistingFileSkip),
+		WithPostProcessors(SidecarProcessor(SidecarOptions{})),
+	)
+
+	template, _ := ParsePathTemplate("{filename}.{ext}")
+	requests, _ := fetch.NewMediaRequests([]model.Media{media}, dir, template)
+	assert.NoError(t, fetch.DownloadFile(requests[0]).Error())
+
+	first, err := ReadSidecar(requests[0].FilePath)
+	assert.NoError(t, err)
+	assert.Nil(t, first.Created)
+
+	// Downloading the same file again doesn't replace its sidecar
+	requests, _ = fetch.NewMediaRequests([]model.Media{media}, dir, template)
+	resp := fetch.DownloadFile(requests[0])
+	assert.NoError(t, resp.Error())
+	assert.True(t, resp.Skipped)
+
+	second, _ := ReadSidecar(requests[0].FilePath)
+	assert.Equal(t, first.DownloadedAt, second.DownloadedAt)
+
+	// Files downloaded before the sidecars were enabled get one
+	assert.NoError(t, os.Remove(requests[0].FilePath+SidecarSuffix))
+	requests, _ = fetch.NewMediaRequests([]model.Media{media}, dir, template)
+	resp = fetch.DownloadFile(requests[0])
+	assert.NoError(t, resp.Error())
+	assert.True(t, resp.Skipped)
+
+	_, err = ReadSidecar(requests[0].FilePath)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,384 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// streamParallel is the number of segments of a stream downloaded at the same time.
+const streamParallel = 4
+
+// Muxer combines the video and audio tracks of a stream into a single file.
+//
+// # Parameters:
+//   - ctx: the context of the download; the muxer should stop when it's canceled.
+//   - videoPath: the path of the file with the video track.
+//   - audioPath: the path of the file with the audio track.
+//   - outputPath: the path of the file to be created.
+type Muxer func(ctx context.Context, videoPath string, audioPath string, outputPath string) error
+
+// FFmpegMuxer returns a Muxer that uses FFmpeg to combine the tracks, without re-encoding them.
+//
+// # Parameters:
+//   - ffmpegPath: the path of the FFmpeg executable; an empty string looks for "ffmpeg" in the PATH.
+func FFmpegMuxer(ffmpegPath string) Muxer {
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+
+	return func(ctx context.Context, videoPath string, audioPath string, outputPath string) error {
+		cmd := exec.CommandContext(ctx, ffmpegPath, "-y", "-loglevel", "error", "-i", videoPath, "-i", audioPath,
+			"-map", "0:v", "-map", "1:a", "-c", "copy", outputPath)
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+
+		return nil
+	}
+}
+
+// StreamResponse is the result of downloading an HLS or DASH stream.
+type StreamResponse struct {
+	// VideoPath is the path of the file with the video track, or an empty string if the stream has no video.
+	VideoPath string
+
+	// AudioPath is the path of the file with the audio track, or an empty string if the stream has no separate audio.
+	AudioPath string
+
+	// FilePath is the path of the file with all the tracks, when the stream has a single track or the tracks were
+	// combined by the Muxer set with WithMuxer; otherwise it's an empty string.
+	FilePath string
+
+	// Bandwidth is the bandwidth, in bits per second, of the video variant that was downloaded.
+	Bandwidth int64
+}
+
+// DownloadStream downloads an HLS (.m3u8) or DASH (.mpd) stream. The variant with the highest bandwidth is chosen, and
+// its segments are downloaded in parallel, with retries, and concatenated.
+//
+// When the video and audio are in separate tracks, they are saved in separate files, next to filePath, like
+// "video.video.mp4" and "video.audio.mp4"; if a Muxer was set with WithMuxer, they are then combined into filePath and
+// the separate files are removed. Streams with a single track are saved straight to filePath.
+//
+// Encrypted HLS streams are not supported, and only the first period of DASH manifests is downloaded.
+//
+// # Parameters:
+//   - url: the URL of the HLS playlist or DASH manifest.
+//   - filePath: the path where the stream will be saved.
+//
+// # Returns:
+//   - A StreamResponse with the paths of the files that were created.
+//   - An error if the stream can't be parsed or downloaded.
+func (f *Fetch) DownloadStream(url string, filePath string) (*StreamResponse, error) {
+	return f.DownloadStreamContext(context.Background(), url, filePath)
+}
+
+// DownloadStreamContext is like DownloadStream, but the download stops when the context is canceled.
+func (f *Fetch) DownloadStreamContext(ctx context.Context, url string, filePath string) (*StreamResponse, error) {
+	manifest, err := f.GetTextContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("could not get stream manifest: %w", err)
+	}
+
+	var video, audio *streamTrack
+	fallbackExt := ".mp4"
+
+	if strings.HasPrefix(strings.TrimSpace(manifest), "#EXTM3U") {
+		video, audio, err = f.hlsTracks(ctx, url, manifest)
+		fallbackExt = ".ts"
+	} else {
+		video, audio, err = dashTracks(url, manifest)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return nil, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	response := &StreamResponse{}
+	if video != nil {
+		response.Bandwidth = video.bandwidth
+	}
+
+	// A single track doesn't need to be combined
+	if video == nil || audio == nil {
+		track := firstTrack(video, audio)
+		if err = f.downloadTrack(ctx, track, filePath); err != nil {
+			return nil, err
+		}
+
+		if video != nil {
+			response.VideoPath = filePath
+		} else {
+			response.AudioPath = filePath
+		}
+
+		response.FilePath = filePath
+		return response, nil
+	}
+
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	response.VideoPath = base + ".video" + video.extension(fallbackExt)
+	response.AudioPath = base + ".audio" + audio.extension(fallbackExt)
+
+	if err = f.downloadTrack(ctx, video, response.VideoPath); err != nil {
+		return nil, err
+	}
+
+	if err = f.downloadTrack(ctx, audio, response.AudioPath); err != nil {
+		return nil, err
+	}
+
+	if f.muxer == nil {
+		return response, nil
+	}
+
+	if err = f.muxer(ctx, response.VideoPath, response.AudioPath, filePath); err != nil {
+		return response, fmt.Errorf("could not combine the tracks: %w", err)
+	}
+
+	_ = os.Remove(response.VideoPath)
+	_ = os.Remove(response.AudioPath)
+
+	response.VideoPath = ""
+	response.AudioPath = ""
+	response.FilePath = filePath
+
+	return response, nil
+}
+
+// region - Private functions
+
+// streamTrack is a variant of a stream, made of segments that are concatenated.
+type streamTrack struct {
+	bandwidth int64
+	init      *streamSegment
+	segments  []streamSegment
+}
+
+// streamSegment is a file, or a range of bytes of a file, with part of a track.
+type streamSegment struct {
+	url    string
+	offset int64
+	// length is the number of bytes of the range, or -1 when the whole file is used
+	length int64
+}
+
+// extension returns the extension of the track's files, like ".ts" or ".mp4".
+func (t *streamTrack) extension(fallback string) string {
+	if len(t.segments) == 0 {
+		return fallback
+	}
+
+	u, err := url.Parse(t.segments[0].url)
+	if err != nil {
+		return fallback
+	}
+
+	switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+	case ".m4s", ".m4v", ".cmfv", ".cmfa":
+		return ".mp4"
+	case ".ts", ".aac", ".m4a", ".mp4", ".webm", ".mp3":
+		return ext
+	default:
+		return fallback
+	}
+}
+
+// firstTrack returns the first track that is not nil.
+func firstTrack(tracks ...*streamTrack) *streamTrack {
+	for _, track := range tracks {
+		if track != nil {
+			return track
+		}
+	}
+
+	return nil
+}
+
+// downloadTrack downloads the segments of the track and concatenates them in the file.
+func (f *Fetch) downloadTrack(ctx context.Context, track *streamTrack, filePath string) error {
+	// A track in a single file is downloaded like any other file, with support to resume and segments
+	if track.init == nil && len(track.segments) == 1 && track.segments[0].length < 0 {
+		request, err := f.NewRequest(track.segments[0].url, filePath)
+		if err != nil {
+			return err
+		}
+
+		request.ExistingFile = ExistingFileResume
+		response := f.DownloadFile(request)
+
+		stop := context.AfterFunc(ctx, response.Cancel)
+		defer stop()
+
+		return response.Error()
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+
+	defer file.Close()
+
+	segments := track.segments
+	if track.init != nil {
+		segments = append([]streamSegment{*track.init}, segments...)
+	}
+
+	// Segments are downloaded in batches and written in order
+	for start := 0; start < len(segments); start += streamParallel {
+		batch := segments[start:min(start+streamParallel, len(segments))]
+		data := make([][]byte, len(batch))
+		errs := make([]error, len(batch))
+
+		var wg sync.WaitGroup
+		for i, segment := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data[i], errs[i] = f.getSegment(ctx, segment)
+			}()
+		}
+
+		wg.Wait()
+
+		for i := range batch {
+			if errs[i] != nil {
+				return errs[i]
+			}
+
+			if _, err = file.Write(data[i]); err != nil {
+				return fmt.Errorf("could not write segment: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getSegment downloads a segment, retrying it according to the retry policy.
+func (f *Fetch) getSegment(ctx context.Context, segment streamSegment) ([]byte, error) {
+	var resp *http.Response
+	var err error
+
+	start := time.Now()
+
+	for attempt := 0; attempt < f.retryPolicy.MaxAttempts(); attempt++ {
+		if attempt > 0 {
+			backoff, limited := f.retryWait(attempt, resp)
+
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+
+			if !f.canRetry(attempt, start, backoff, statusCode, err) {
+				return nil, err
+			}
+
+			log.WithFields(log.Fields{
+				"attempt": attempt,
+				"error":   err,
+				"url":     segment.url,
+			}).Warn("failed to download stream segment; retrying in ", backoff)
+
+			f.notifyRetry(RetryEvent{
+				Url:         segment.url,
+				Attempt:     attempt,
+				StatusCode:  statusCode,
+				Err:         err,
+				Wait:        backoff,
+				RateLimited: limited,
+			})
+
+			if sErr := sleepContext(ctx, backoff); sErr != nil {
+				return nil, sErr
+			}
+		}
+
+		req, rErr := http.NewRequestWithContext(ctx, "GET", segment.url, nil)
+		if rErr != nil {
+			return nil, fmt.Errorf("failed to create request: %w", rErr)
+		}
+
+		for key, value := range f.headers {
+			req.Header.Set(key, value)
+		}
+
+		req.Header.Set("User-Agent", userAgent)
+		if segment.length >= 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", segment.offset, segment.offset+segment.length-1))
+		}
+
+		resp, err = f.httpClient.Do(req)
+		if err != nil {
+			err = fmt.Errorf("request error: %w", err)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected status: %d", resp.StatusCode)
+			continue
+		}
+
+		var body io.Reader = &throttledReader{ctx: ctx, reader: resp.Body, limiters: []*rate.Limiter{f.bandwidth}}
+
+		// A server that ignores the range sends the whole file, so we cut the part we need
+		if segment.length >= 0 && resp.StatusCode == http.StatusOK {
+			if _, err = io.CopyN(io.Discard, body, segment.offset); err == nil {
+				body = io.LimitReader(body, segment.length)
+			}
+		}
+
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(body)
+		}
+
+		resp.Body.Close()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			err = fmt.Errorf("segment interrupted: %w", err)
+			continue
+		}
+
+		return data, nil
+	}
+
+	return nil, err
+}
+
+// resolveUrl resolves a URL that can be relative to the URL of the manifest.
+func resolveUrl(base *url.URL, ref string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL '%s': %w", ref, err)
+	}
+
+	return base.ResolveReference(u).String(), nil
+}
+
+// endregion
@@ -0,0 +1,208 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newStreamServer serves the files in the map; each path fails once before succeeding, to test the retries.
+func newStreamServer(files map[string]string) *httptest.Server {
+	failed := make(map[string]*atomic.Bool)
+	for name := range files {
+		failed[name] = &atomic.Bool{}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, exists := files[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, ".ts") && !failed[r.URL.Path].Swap(true) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+	}))
+}
+
+func TestFetch_DownloadStream_Hls(t *testing.T) {
+	server := newStreamServer(map[string]string{
+		"/master.m3u8": "#EXTM3U\n" +
+			`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,URI="audio/index.m3u8"` + "\n" +
+			`#EXT-X-STREAM-INF:BANDWIDTH=500000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"` + "\n" +
+			"low/index.m3u8\n" +
+			`#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"` + "\n" +
+			"high/index.m3u8\n",
+		"/low/index.m3u8":   "#EXTM3U\n#EXTINF:4,\nlow0.ts\n#EXT-X-ENDLIST\n",
+		"/high/index.m3u8":  "#EXTM3U\n#EXTINF:4,\nv0.ts\n#EXTINF:4,\nv1.ts\n#EXTINF:4,\nv2.ts\n#EXT-X-ENDLIST\n",
+		"/audio/index.m3u8": "#EXTM3U\n#EXTINF:4,\na0.ts\n#EXTINF:4,\na1.ts\n#EXT-X-ENDLIST\n",
+		"/high/v0.ts":       "video0",
+		"/high/v1.ts":       "video1",
+		"/high/v2.ts":       "video2",
+		"/audio/a0.ts":      "audio0",
+		"/audio/a1.ts":      "audio1",
+	})
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetch := New(nil, 2)
+	response, err := fetch.DownloadStream(server.URL+"/master.m3u8", filepath.Join(dir, "video.mp4"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2000000), response.Bandwidth)
+	assert.Equal(t, filepath.Join(dir, "video.video.ts"), response.VideoPath)
+	assert.Equal(t, filepath.Join(dir, "video.audio.ts"), response.AudioPath)
+	assert.Empty(t, response.FilePath)
+
+	video, _ := os.ReadFile(response.VideoPath)
+	audio, _ := os.ReadFile(response.AudioPath)
+	assert.Equal(t, "video0video1video2", string(video))
+	assert.Equal(t, "audio0audio1", string(audio))
+}
+
+func TestFetch_DownloadStream_Dash(t *testing.T) {
+	manifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" mediaPresentationDuration="PT6S">
+  <Period>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number%03d$.m4s"
+        timescale="1000" duration="2000" startNumber="1"/>
+      <Representation id="480" bandwidth="800000"/>
+      <Representation id="720" bandwidth="1500000"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4">
+      <Representation id="audio" bandwidth="128000">
+        <BaseURL>audio.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	server := newStreamServer(map[string]string{
+		"/DASHPlaylist.mpd": manifest,
+		"/720/init.mp4":     "init-",
+		"/720/001.m4s":      "v1-",
+		"/720/002.m4s":      "v2-",
+		"/720/003.m4s":      "v3",
+		"/audio.mp4":        "audio",
+	})
+	defer server.Close()
+
+	var muxed []string
+	muxer := func(ctx context.Context, videoPath string, audioPath string, outputPath string) error {
+		video, _ := os.ReadFile(videoPath)
+		audio, _ := os.ReadFile(audioPath)
+		muxed = []string{string(video), string(audio)}
+		return os.WriteFile(outputPath, append(video, audio...), 0644)
+	}
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "video.mp4")
+	fetch := New(nil, 0, WithMuxer(muxer))
+	response, err := fetch.DownloadStream(server.URL+"/DASHPlaylist.mpd", filePath)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500000), response.Bandwidth)
+	assert.Equal(t, []string{"init-v1-v2-v3", "audio"}, muxed)
+	assert.Equal(t, filePath, response.FilePath)
+	assert.Empty(t, response.VideoPath)
+	assert.NoFileExists(t, filepath.Join(dir, "video.video.mp4"))
+	assert.NoFileExists(t, filepath.Join(dir, "video.audio.mp4"))
+
+	content, _ := os.ReadFile(filePath)
+	assert.Equal(t, "init-v1-v2-v3audio", string(content))
+}
+
+func TestParseHlsMedia_ByteRanges(t *testing.T) {
+	base, _ := url.Parse("https://example.com/stream/index.m3u8")
+	playlist := "#EXTM3U\n" +
+		`#EXT-X-MAP:URI="main.mp4",BYTERANGE="100@0"` + "\n" +
+		"#EXT-X-BYTERANGE:500@100\n#EXTINF:4,\nmain.mp4\n" +
+		"#EXT-X-BYTERANGE:400\n#EXTINF:4,\nmain.mp4\n"
+
+	track, err := parseHlsMedia(base, playlist)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &streamSegment{url: "https://example.com/stream/main.mp4", offset: 0, length: 100}, track.init)
+	assert.Equal(t, []streamSegment{
+		{url: "https://example.com/stream/main.mp4", offset: 100, length: 500},
+		{url: "https://example.com/stream/main.mp4", offset: 600, length: 400},
+	}, track.segments)
+
+	_, err = parseHlsMedia(base, "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n#EXTINF:4,\n0.ts\n")
+	assert.Error(t, err)
+}
+
+func TestDashTracks_SegmentTimeline(t *testing.T) {
+	manifest := `<MPD mediaPresentationDuration="PT10S"><Period><AdaptationSet contentType="video">
+<Representation id="v" bandwidth="1000">
+  <SegmentTemplate media="v/$Time$.m4s" timescale="10">
+    <SegmentTimeline><S t="0" d="20" r="2"/><S d="40"/></SegmentTimeline>
+  </SegmentTemplate>
+</Representation></AdaptationSet></Period></MPD>`
+
+	video, audio, err := dashTracks("https://example.com/a/manifest.mpd", manifest)
+
+	assert.NoError(t, err)
+	assert.Nil(t, audio)
+
+	urls := make([]string, 0)
+	for _, segment := range video.segments {
+		urls = append(urls, segment.url)
+	}
+
+	expected := make([]string, 0)
+	for _, start := range []int{0, 20, 40, 60} {
+		expected = append(expected, fmt.Sprintf("https://example.com/a/v/%d.m4s", start))
+	}
+
+	assert.Equal(t, expected, urls)
+}
+
+func TestDashTracks_InvalidTimeline(t *testing.T) {
+	manifest := `<MPD mediaPresentationDuration="%s"><Period><AdaptationSet contentType="video">
+<Representation id="v" bandwidth="1000">
+  <SegmentTemplate media="v/$Time$.m4s" timescale="10"><SegmentTimeline>%s</SegmentTimeline></SegmentTemplate>
+</Representation></AdaptationSet></Period></MPD>`
+
+	// Segments without a duration would repeat forever
+	_, _, err := dashTracks("https://example.com/manifest.mpd", fmt.Sprintf(manifest, "PT10S", `<S t="0" d="0" r="-1"/>`))
+	assert.ErrorContains(t, err, "invalid segment duration")
+
+	_, _, err = dashTracks("https://example.com/manifest.mpd", fmt.Sprintf(manifest, "PT10S", `<S d="0" r="1000"/>`))
+	assert.ErrorContains(t, err, "invalid segment duration")
+
+	// Too many segments
+	_, _, err = dashTracks("https://example.com/manifest.mpd",
+		fmt.Sprintf(manifest, "PT10S", `<S d="1" r="999999999"/>`))
+	assert.ErrorContains(t, err, "more than")
+
+	_, _, err = dashTracks("https://example.com/manifest.mpd", fmt.Sprintf(manifest, "P10000D", `<S d="1" r="-1"/>`))
+	assert.ErrorContains(t, err, "more than")
+
+	_, _, err = dashTracks("https://example.com/manifest.mpd", `<MPD mediaPresentationDuration="P10000D"><Period>
+<AdaptationSet contentType="video"><Representation id="v" bandwidth="1000">
+  <SegmentTemplate media="v/$Number$.m4s" timescale="10" duration="1"/>
+</Representation></AdaptationSet></Period></MPD>`)
+	assert.ErrorContains(t, err, "more than")
+}
+
+func TestParseIsoDuration(t *testing.T) {
+	assert.Equal(t, 3723.5, parseIsoDuration("PT1H2M3.5S"))
+	assert.Equal(t, 86400.0+60, parseIsoDuration("P1DT1M"))
+	assert.Equal(t, 0.0, parseIsoDuration("invalid"))
+}
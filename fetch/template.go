@@ -0,0 +1,225 @@
+package fetch
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+// defaultTimeLayout is the layout used to render time fields that don't specify one.
+const defaultTimeLayout = "20060102_150405"
+
+// PathTemplate renders file paths from the information found in a Media object.
+//
+// A template is a path, using "/" as separator, where fields inside curly braces are replaced by values from the
+// media, like "{extractor}/{name}/{created:2006-01-02}_{id}.{ext}". The fields available are:
+//   - extractor: the name of the extractor, like "Reddit".
+//   - type: the type of the media, like "Image".
+//   - ext: the extension of the media file.
+//   - filename: the name of the file in the URL, without the extension.
+//   - any key in Media.Metadata, like "name", "source", "created" or "id".
+//
+// A field can have a format after a colon: time values use it as a Go time layout, and other values use it as a
+// fmt verb, like "{id:%08d}". Fields that don't exist in the media are rendered as empty strings.
+type PathTemplate struct {
+	pattern  string
+	segments [][]templateToken
+}
+
+type templateToken struct {
+	literal string
+	field   string
+	format  string
+}
+
+// ParsePathTemplate parses a template used to render file paths from Media objects.
+//
+// # Parameters:
+//   - pattern: the template, like "{extractor}/{name}/{created:2006-01-02}_{id}.{ext}".
+//
+// # Returns:
+//   - The parsed PathTemplate.
+//   - An error if the pattern is not valid.
+func ParsePathTemplate(pattern string) (*PathTemplate, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("empty path template")
+	}
+
+	segments := make([][]templateToken, 0)
+
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "" {
+			continue
+		}
+
+		tokens, err := parseSegment(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path template '%s': %w", pattern, err)
+		}
+
+		segments = append(segments, tokens)
+	}
+
+	return &PathTemplate{pattern: pattern, segments: segments}, nil
+}
+
+// String returns the pattern used to create the template.
+func (t *PathTemplate) String() string {
+	return t.pattern
+}
+
+// Render creates a relative file path for the media. Every directory and file name in the path is sanitized to be
+// valid in Linux, Windows and macOS, and long names are truncated.
+//
+// # Parameters:
+//   - media: the Media object used to fill the fields of the template.
+//
+// # Returns:
+//   - The relative file path, using the separator of the current OS.
+func (t *PathTemplate) Render(media model.Media) string {
+	parts := make([]string, 0, len(t.segments))
+
+	for _, tokens := range t.segments {
+		var builder strings.Builder
+		for _, token := range tokens {
+			if token.field == "" {
+				builder.WriteString(token.literal)
+			} else {
+				builder.WriteString(renderField(media, token))
+			}
+		}
+
+		name := builder.String()
+		if name == "." || name == ".." {
+			name = "_"
+		}
+
+		parts = append(parts, SanitizeFileName(name))
+	}
+
+	return filepath.Join(parts...)
+}
+
+// NewMediaRequests creates download requests for the media, using the template to build the file paths. Media that
+// would be saved in the same path get a numeric suffix, like "name (1).jpg".
+//
+// # Parameters:
+//   - media: the media to be downloaded.
+//   - directory: the directory where the rendered paths are created.
+//   - template: the template used to render the file paths.
+//
+// # Returns:
+//   - A slice of *Request, in the same order as the media.
+//   - An error if any request can't be created.
+func (f *Fetch) NewMediaRequests(media []model.Media, directory string, template *PathTemplate) ([]*Request, error) {
+	requests := make([]*Request, 0, len(media))
+	used := make(map[string]bool)
+
+	for _, m := range media {
+		filePath := uniquePath(filepath.Join(directory, template.Render(m)), func(p string) bool {
+			return used[p]
+		})
+
+		used[filePath] = true
+
+		request, err := f.NewRequest(m.Url, filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		current := m
+		request.Media = &current
+		if hash, ok := m.Metadata["hash"].(string); ok {
+			request.ExpectedHash = hash
+		}
+
+		if mirrors, ok := m.Metadata["mirrors"].([]string); ok {
+			request.Mirrors = mirrors
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+// region - Private functions
+
+func parseSegment(segment string) ([]templateToken, error) {
+	tokens := make([]templateToken, 0)
+
+	for len(segment) > 0 {
+		start := strings.IndexAny(segment, "{}")
+		if start == -1 {
+			tokens = append(tokens, templateToken{literal: segment})
+			break
+		}
+
+		if segment[start] == '}' {
+			return nil, fmt.Errorf("unexpected '}'")
+		}
+
+		if start > 0 {
+			tokens = append(tokens, templateToken{literal: segment[:start]})
+		}
+
+		end := strings.IndexAny(segment[start+1:], "{}")
+		if end == -1 || segment[start+1+end] != '}' {
+			return nil, fmt.Errorf("unclosed '{'")
+		}
+
+		field, format, _ := strings.Cut(segment[start+1:start+1+end], ":")
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field name")
+		}
+
+		tokens = append(tokens, templateToken{field: field, format: format})
+		segment = segment[start+end+2:]
+	}
+
+	return tokens, nil
+}
+
+func renderField(media model.Media, token templateToken) string {
+	var value interface{}
+
+	switch token.field {
+	case "extractor":
+		value = media.Extractor.String()
+	case "type":
+		value = media.Type.String()
+	case "ext":
+		value = media.Extension
+	case "filename":
+		base := path.Base(strings.SplitN(media.Url, "?", 2)[0])
+		value = strings.TrimSuffix(base, path.Ext(base))
+	default:
+		v, exists := media.Metadata[token.field]
+		if !exists || v == nil {
+			return ""
+		}
+
+		value = v
+	}
+
+	if t, ok := value.(time.Time); ok {
+		if token.format == "" {
+			return t.Format(defaultTimeLayout)
+		}
+
+		return t.Format(token.format)
+	}
+
+	if token.format != "" {
+		return fmt.Sprintf(token.format, value)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// endregion
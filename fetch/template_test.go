@@ -0,0 +1,95 @@
+package fetch
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib/internal/model"
+)
+
+func TestPathTemplate_Render(t *testing.T) {
+	template, err := ParsePathTemplate("{extractor}/{name}/{created:2006-01-02}_{id}.{ext}")
+	assert.NoError(t, err)
+
+	media := model.NewMedia("https://i.redd.it/abc123.jpg", model.Reddit, map[string]interface{}{
+		"name":    "atomicbrunette18",
+		"created": time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC),
+		"id":      "1bxsmnr",
+	})
+
+	assert.Equal(t, filepath.Join("Reddit", "atomicbrunette18", "2024-03-05_1bxsmnr.jpg"), template.Render(media))
+}
+
+func TestPathTemplate_RenderMissingFieldsAndFormat(t *testing.T) {
+	template, _ := ParsePathTemplate("{source}/{filename}_{id:%05d}.{ext}")
+	media := model.NewMedia("https://fapello.com/content/file.mp4?x=1", model.Fapello, map[string]interface{}{
+		"id": 42,
+	})
+
+	assert.Equal(t, filepath.Join("_", "file_00042.mp4"), template.Render(media))
+}
+
+func TestPathTemplate_RenderSanitizesValues(t *testing.T) {
+	template, _ := ParsePathTemplate("{name}/{title}.{ext}")
+	media := model.NewMedia("https://example.com/file.png", model.Generic, map[string]interface{}{
+		"name":  "..",
+		"title": `a/b\c:d*e?"f"<g>|h`,
+	})
+
+	assert.Equal(t, filepath.Join("_", "a_b_c_d_e__f__g__h.png"), template.Render(media))
+}
+
+func TestPathTemplate_Invalid(t *testing.T) {
+	_, err := ParsePathTemplate("{name/{id}")
+	assert.Error(t, err)
+
+	_, err = ParsePathTemplate("name}")
+	assert.Error(t, err)
+
+	_, err = ParsePathTemplate("{}")
+	assert.Error(t, err)
+
+	_, err = ParsePathTemplate("")
+	assert.Error(t, err)
+}
+
+func TestSanitizeFileName_Reserved(t *testing.T) {
+	assert.Equal(t, "_CON.txt", SanitizeFileName("CON.txt"))
+	assert.Equal(t, "_CON.tar.gz", SanitizeFileName("CON.tar.gz"))
+	assert.Equal(t, "CONSOLE.txt", SanitizeFileName("CONSOLE.txt"))
+	assert.Equal(t, "_nul", SanitizeFileName("nul"))
+	assert.Equal(t, "_", SanitizeFileName(" . "))
+}
+
+func TestSanitizeFileName_Truncate(t *testing.T) {
+	name := SanitizeFileName(strings.Repeat("é", 300) + ".jpg")
+
+	assert.LessOrEqual(t, len(name), maxNameLength)
+	assert.True(t, strings.HasSuffix(name, "é.jpg"))
+
+	// The stem is never trimmed to nothing
+	assert.Equal(t, "_.jpg", SanitizeFileName(strings.Repeat(".", 300)+"x.jpg"))
+}
+
+func TestFetch_NewMediaRequests(t *testing.T) {
+	template, _ := ParsePathTemplate("{name}.{ext}")
+	media := []model.Media{
+		model.NewMedia("https://example.com/1.jpg", model.Coomer, map[string]interface{}{
+			"name": "user",
+			"hash": "sha256:e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c",
+		}),
+		model.NewMedia("https://example.com/2.jpg", model.Coomer, map[string]interface{}{"name": "user"}),
+	}
+
+	fetch := New(nil, 0)
+	requests, err := fetch.NewMediaRequests(media, "downloads", template)
+
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("downloads", "user.jpg"), requests[0].FilePath)
+	assert.Equal(t, filepath.Join("downloads", "user (1).jpg"), requests[1].FilePath)
+	assert.Equal(t, media[0].Metadata["hash"], requests[0].ExpectedHash)
+	assert.Equal(t, media[1].Url, requests[1].Media.Url)
+}
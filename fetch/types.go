@@ -6,7 +6,11 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
+
+	"github.com/vegidio/umd-lib/internal/model"
+	"golang.org/x/time/rate"
 )
 
 // Request
@@ -15,21 +19,68 @@ type Request struct {
 	Url      string
 	FilePath string
 
+	// ExpectedSize is the size, in bytes, that the downloaded file must have. Zero means that the size is not verified,
+	// other than against the Content-Length sent by the server.
+	ExpectedSize int64
+
+	// ExpectedHash is the hash that the downloaded file must have, in the format "<algorithm>:<hex value>". The
+	// supported algorithms are md5, sha1, sha256 and sha512. Empty means that the hash is not verified.
+	ExpectedHash string
+
+	// ExistingFile defines what happens if a file already exists in FilePath. The default is to use the policy set in
+	// the Fetch instance.
+	ExistingFile ExistingFilePolicy
+
+	// BandwidthLimit is the maximum number of bytes per second used by this download; zero means no limit, other than
+	// the one set in the Fetch instance.
+	BandwidthLimit int64
+
+	// Segments is the number of connections used to download the file in parallel, when the server supports ranges;
+	// 1 downloads the file in a single stream, and zero uses the setting of the Fetch instance.
+	Segments int
+
+	// Mirrors are other URLs of the same file. When the download fails with a connection error, including a connection
+	// that drops in the middle of the file, or a server error (5xx), it continues from the next mirror; the mirrors,
+	// and Url, are tried from the fastest to the slowest, as measured in the previous downloads of the Fetch instance.
+	Mirrors []string
+
+	// Media is the media used to create the request, if any; see Fetch.NewMediaRequests.
+	Media *model.Media
+
 	httpReq *http.Request
 }
 
 // Response
 
+// Response is a download started by Fetch.DownloadFile. The progress of the download can be read at any time, from any
+// goroutine, with Stats; the other fields are only set when the download is complete, so they must be read after Done
+// is closed or Error returns.
 type Response struct {
 	Request    *Request
 	StatusCode int
-	Size       int64
-	Downloaded int64
-	Progress   float64
 	Done       chan struct{} `json:"-"`
 
-	cancel context.CancelFunc
-	err    error
+	// FilePath is the path of the downloaded file. It's the same as Request.FilePath, unless the file got another name
+	// because of the ExistingFileRename policy, or was renamed by DetectContent.
+	FilePath string
+
+	// Hash is the hash of the downloaded file, in the format "<algorithm>:<hex value>". It uses the same algorithm as
+	// Request.ExpectedHash, or sha256 when no hash is expected.
+	Hash string
+
+	// Skipped is true when the download was skipped because the same file already exists in FilePath.
+	Skipped bool
+
+	cancel    context.CancelFunc
+	err       error
+	bandwidth *rate.Limiter
+	meter     *speedMeter
+
+	// size is zero before the server responds, and -1 when the server doesn't send it
+	size       atomic.Int64
+	downloaded atomic.Int64
+	canceled   atomic.Bool
+	paused     atomic.Bool
 }
 
 // Error waits for the download to complete and returns any error that occurred during the process.
@@ -50,13 +101,26 @@ func (r *Response) IsComplete() bool {
 
 // Cancel stops the download process.
 func (r *Response) Cancel() {
+	if !r.IsComplete() {
+		r.canceled.Store(true)
+	}
+
+	r.cancel()
+}
+
+// pause stops the download to be paused by the Manager; unlike Cancel, it's not reported as canceled.
+func (r *Response) pause() {
+	if !r.IsComplete() {
+		r.paused.Store(true)
+	}
+
 	r.cancel()
 }
 
-// Bytes read the file specified in the Request's FilePath and return its content as a byte slice.
+// Bytes read the file specified in FilePath and return its content as a byte slice.
 // It returns an error if the file cannot be read.
 func (r *Response) Bytes() ([]byte, error) {
-	data, err := os.ReadFile(r.Request.FilePath)
+	data, err := os.ReadFile(r.FilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
@@ -82,15 +146,15 @@ func (r *Response) Track(callback func(completed, total int64, progress float64)
 	for {
 		select {
 		case <-ticker.C:
-			if r.Downloaded != oldValue {
-				oldValue = r.Downloaded
-				callback(r.Downloaded, r.Size, r.Progress)
+			if stats := r.Stats(); stats.Downloaded != oldValue {
+				oldValue = stats.Downloaded
+				callback(stats.Downloaded, stats.Size, stats.Progress)
 			}
 
 		case <-r.Done:
-			if r.Downloaded != oldValue {
-				oldValue = r.Downloaded
-				callback(r.Downloaded, r.Size, r.Progress)
+			if stats := r.Stats(); stats.Downloaded != oldValue {
+				oldValue = stats.Downloaded
+				callback(stats.Downloaded, stats.Size, stats.Progress)
 			}
 			return r.Error()
 		}
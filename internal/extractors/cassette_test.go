@@ -0,0 +1,28 @@
+package extractors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vegidio/umd-lib/fetch"
+)
+
+// useCassette returns the options that make the requests of the test, including the ones sent by the extractors, be
+// answered from the cassette in testdata/cassettes, so the test runs offline. Set UMD_RECORD=1 to send the requests to
+// the sites and record the cassette again; tokens and cookies are scrubbed before the cassette is saved.
+func useCassette(t *testing.T) []fetch.Option {
+	cassette := filepath.Join("testdata", "cassettes", t.Name()+".json")
+
+	mode := fetch.RecorderReplay
+	if os.Getenv("UMD_RECORD") == "1" {
+		mode = fetch.RecorderRecord
+	}
+
+	recorder, err := fetch.NewRecorder(cassette, mode, fetch.RecorderOptions{})
+	if err != nil {
+		t.Fatalf("%v; run the test with UMD_RECORD=1 to record the cassette", err)
+	}
+
+	return []fetch.Option{fetch.WithRecorder(recorder)}
+}
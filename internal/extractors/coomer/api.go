@@ -7,10 +7,21 @@ import (
 	"github.com/vegidio/umd-lib/internal/model"
 )
 
-var f = fetch.New(nil, 10)
+// defaultFetch is the Fetch instance shared by the extractors created without options.
+var defaultFetch = fetch.New(nil, 10)
+
+// newFetch returns the Fetch instance used by an extractor; extractors with options get their own instance.
+func newFetch(options []fetch.Option) *fetch.Fetch {
+	if len(options) == 0 {
+		return defaultFetch
+	}
+
+	return fetch.New(nil, 10, options...)
+}
+
 var baseUrl string
 
-func getUser(service string, user string) <-chan model.Result[Response] {
+func getUser(f *fetch.Fetch, service string, user string) <-chan model.Result[Response] {
 	out := make(chan model.Result[Response])
 
 	go func() {
@@ -34,7 +45,7 @@ func getUser(service string, user string) <-chan model.Result[Response] {
 			}
 
 			for _, post := range posts {
-				result := <-getPost(post.Service, post.User, post.Id)
+				result := <-getPost(f, post.Service, post.User, post.Id)
 				if result.Err != nil {
 					out <- model.Result[Response]{Err: result.Err}
 					continue
@@ -50,7 +61,7 @@ func getUser(service string, user string) <-chan model.Result[Response] {
 	return out
 }
 
-func getPost(service string, user string, id string) <-chan model.Result[Response] {
+func getPost(f *fetch.Fetch, service string, user string, id string) <-chan model.Result[Response] {
 	out := make(chan model.Result[Response])
 
 	go func() {
@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"github.com/samber/lo"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
+	"path"
 	"regexp"
 	"slices"
+	"strings"
 )
 
+var regexHash = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
 type Coomer struct {
 	Metadata model.Metadata
 
@@ -19,9 +24,10 @@ type Coomer struct {
 	services         string
 	responseMetadata model.Metadata
 	external         model.External
+	fetch            *fetch.Fetch
 }
 
-func New(url string, metadata model.Metadata, external model.External) model.Extractor {
+func New(url string, metadata model.Metadata, external model.External, options ...fetch.Option) model.Extractor {
 	switch {
 	case utils.HasHost(url, "coomer.st") || utils.HasHost(url, "coomer.party"):
 		baseUrl = "https://coomer.st"
@@ -33,6 +39,7 @@ func New(url string, metadata model.Metadata, external model.External) model.Ext
 			extractor: model.Coomer,
 			services:  "onlyfans|fansly|candfans",
 			external:  external,
+			fetch:     newFetch(options),
 		}
 	case utils.HasHost(url, "kemono.cr") || utils.HasHost(url, "kemono.party"):
 		baseUrl = "https://kemono.cr"
@@ -44,6 +51,7 @@ func New(url string, metadata model.Metadata, external model.External) model.Ext
 			extractor: model.Kemono,
 			services:  "patreon|fanbox|discord|fantia|afdian|boosty|gumroad|subscribestar|dlsite",
 			external:  external,
+			fetch:     newFetch(options),
 		}
 	}
 
@@ -158,9 +166,9 @@ func (c *Coomer) fetchMedia(
 
 		switch s := source.(type) {
 		case SourceUser:
-			responses = getUser(s.Service, s.name)
+			responses = getUser(c.fetch, s.Service, s.name)
 		case SourcePost:
-			responses = getPost(s.Service, s.name, s.Id)
+			responses = getPost(c.fetch, s.Service, s.name, s.Id)
 		}
 
 		for response := range responses {
@@ -195,6 +203,10 @@ func (c *Coomer) postToMedia(response Response) []model.Media {
 				"source":  response.Post.Service,
 				"name":    response.Post.User,
 				"created": response.Post.Published.Time,
+				"hash":    pathToHash(image.Path),
+				"mirrors": mirrorUrls(url, image.Path),
+				"id":      response.Post.Id,
+				"page":    postPage(response.Post),
 			})
 
 			media = append(media, newMedia)
@@ -208,6 +220,10 @@ func (c *Coomer) postToMedia(response Response) []model.Media {
 				"source":  response.Post.Service,
 				"name":    response.Post.User,
 				"created": response.Post.Published.Time,
+				"hash":    pathToHash(video.Path),
+				"mirrors": mirrorUrls(url, video.Path),
+				"id":      response.Post.Id,
+				"page":    postPage(response.Post),
 			})
 
 			media = append(media, newMedia)
@@ -218,3 +234,40 @@ func (c *Coomer) postToMedia(response Response) []model.Media {
 }
 
 // endregion
+
+// region - Private functions
+
+// pathToHash extracts the SHA-256 hash from the path of a file, like /ab/cd/<sha256>.jpg; the hash is returned in the
+// format "sha256:<hex value>", or an empty string if the path doesn't contain a hash.
+func pathToHash(filePath string) string {
+	name := strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+	if !regexHash.MatchString(name) {
+		return ""
+	}
+
+	return "sha256:" + strings.ToLower(name)
+}
+
+// postPage returns the URL of the page of the post, like https://coomer.st/onlyfans/user/<user>/post/<id>.
+func postPage(post *Post) string {
+	return fmt.Sprintf("%s/%s/user/%s/post/%s", baseUrl, post.Service, post.User, post.Id)
+}
+
+// mirrorUrls returns the other URLs of a file: the same path in the file servers n1 to n4, and in the main host. The
+// file servers are often down or slow, so the downloader can fail over between them.
+func mirrorUrls(fileUrl string, filePath string) []string {
+	domain := strings.TrimPrefix(baseUrl, "https://")
+	candidates := make([]string, 0, 5)
+
+	for i := 1; i <= 4; i++ {
+		candidates = append(candidates, fmt.Sprintf("https://n%d.%s/data%s", i, domain, filePath))
+	}
+
+	candidates = append(candidates, baseUrl+"/data"+filePath)
+
+	return lo.Filter(candidates, func(candidate string, _ int) bool {
+		return candidate != fileUrl
+	})
+}
+
+// endregion
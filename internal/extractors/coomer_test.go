@@ -8,9 +8,11 @@ import (
 )
 
 func TestCoomer_QueryUser(t *testing.T) {
+	options := useCassette(t)
+
 	const NumberOfPosts = 50
 
-	extractor, _ := umd.New(nil).FindExtractor("https://coomer.st/onlyfans/user/melindalondon")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://coomer.st/onlyfans/user/melindalondon")
 	resp, _ := extractor.QueryMedia(NumberOfPosts, nil, true)
 	err := resp.Error()
 
@@ -21,7 +23,9 @@ func TestCoomer_QueryUser(t *testing.T) {
 }
 
 func TestCoomer_QueryPost(t *testing.T) {
-	extractor, _ := umd.New(nil).FindExtractor("https://coomer.st/onlyfans/user/melindalondon/post/357160243")
+	options := useCassette(t)
+
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://coomer.st/onlyfans/user/melindalondon/post/357160243")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	err := resp.Error()
 
@@ -30,4 +34,5 @@ func TestCoomer_QueryPost(t *testing.T) {
 	assert.Equal(t, model.Image, resp.Media[0].Type)
 	assert.Equal(t, "onlyfans", resp.Media[0].Metadata["source"])
 	assert.Equal(t, "melindalondon", resp.Media[0].Metadata["name"])
+	assert.Regexp(t, `^sha256:[a-f0-9]{64}$`, resp.Media[0].Metadata["hash"])
 }
@@ -12,9 +12,19 @@ import (
 
 const BaseUrl = "https://fapello.com/"
 
-var f = fetch.New(nil, 0)
+// defaultFetch is the Fetch instance shared by the extractors created without options.
+var defaultFetch = fetch.New(nil, 0)
 
-func getLinks(name string, limit int) ([]string, error) {
+// newFetch returns the Fetch instance used by an extractor; extractors with options get their own instance.
+func newFetch(options []fetch.Option) *fetch.Fetch {
+	if len(options) == 0 {
+		return defaultFetch
+	}
+
+	return fetch.New(nil, 0, options...)
+}
+
+func getLinks(f *fetch.Fetch, name string, limit int) ([]string, error) {
 	links := make([]string, 0)
 	numPages := 1
 
@@ -63,7 +73,7 @@ func getLinks(name string, limit int) ([]string, error) {
 	return links, nil
 }
 
-func getPost(url string, name string) (*Post, error) {
+func getPost(f *fetch.Fetch, url string, name string) (*Post, error) {
 	mediaUrl := ""
 
 	matches := regexp.MustCompile(`/(\d+)/?$`).FindStringSubmatch(url)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
 	"regexp"
@@ -19,12 +21,13 @@ type Fapello struct {
 	source           model.SourceType
 	responseMetadata model.Metadata
 	external         model.External
+	fetch            *fetch.Fetch
 }
 
-func New(url string, metadata model.Metadata, external model.External) model.Extractor {
+func New(url string, metadata model.Metadata, external model.External, options ...fetch.Option) model.Extractor {
 	switch {
 	case utils.HasHost(url, "fapello.com"):
-		return &Fapello{Metadata: metadata, url: url, external: external}
+		return &Fapello{Metadata: metadata, url: url, external: external, fetch: newFetch(options)}
 	}
 
 	return nil
@@ -170,9 +173,10 @@ func (f *Fapello) fetchPost(source SourcePost) <-chan model.Result[Post] {
 
 		link := fmt.Sprintf("https://fapello.com/%s/%s", source.name, source.Id)
 
-		post, err := getPost(link, source.name)
+		post, err := getPost(f.fetch, link, source.name)
 		if err != nil {
 			result <- model.Result[Post]{Err: err}
+			return
 		}
 
 		result <- model.Result[Post]{Data: *post}
@@ -187,16 +191,22 @@ func (f *Fapello) fetchModel(source SourceModel, limit int) <-chan model.Result[
 	go func() {
 		defer close(result)
 
-		links, err := getLinks(source.name, limit)
+		links, err := getLinks(f.fetch, source.name, limit)
 		if err != nil {
 			result <- model.Result[Post]{Err: err}
 			return
 		}
 
 		for _, link := range links {
-			post, postErr := getPost(link, source.name)
+			// A broken post doesn't stop the other posts of the model from being fetched
+			post, postErr := getPost(f.fetch, link, source.name)
 			if postErr != nil {
-				result <- model.Result[Post]{Err: postErr}
+				log.WithFields(log.Fields{
+					"error": postErr,
+					"url":   link,
+				}).Warn("failed to fetch Fapello post; skipping it")
+
+				continue
 			}
 
 			result <- model.Result[Post]{Data: *post}
@@ -213,11 +223,15 @@ func (f *Fapello) fetchModel(source SourceModel, limit int) <-chan model.Result[
 func postsToMedia(post Post, sourceName string) []model.Media {
 	now := time.Date(1980, time.October, 6, 17, 7, 0, 0, time.UTC)
 
+	// Fapello doesn't show when the posts were published, so "created" only keeps the posts in order; it's marked as
+	// synthetic, so it's not used as the real time of the media
 	return []model.Media{model.NewMedia(post.Url, model.Fapello, map[string]interface{}{
-		"id":      post.Id,
-		"name":    post.Name,
-		"source":  strings.ToLower(sourceName),
-		"created": now.Add(time.Duration(post.Id*24) * time.Hour),
+		"id":                post.Id,
+		"name":              post.Name,
+		"source":            strings.ToLower(sourceName),
+		"created":           now.Add(time.Duration(post.Id*24) * time.Hour),
+		"created_synthetic": true,
+		"page":              fmt.Sprintf("%s%s/%d/", BaseUrl, post.Name, post.Id),
 	})}
 }
 
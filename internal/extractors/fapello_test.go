@@ -8,9 +8,11 @@ import (
 )
 
 func TestFapello_QueryPost(t *testing.T) {
+	options := useCassette(t)
+
 	const NumberOfPosts = 1
 
-	extractor, _ := umd.New(nil).FindExtractor("https://fapello.com/eva-padlock/1552/")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://fapello.com/eva-padlock/1552/")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	err := resp.Error()
 
@@ -18,12 +20,18 @@ func TestFapello_QueryPost(t *testing.T) {
 	assert.Equal(t, NumberOfPosts, len(resp.Media))
 	assert.Equal(t, "post", resp.Media[0].Metadata["source"])
 	assert.Equal(t, "eva-padlock", resp.Media[0].Metadata["name"])
+
+	// Fapello doesn't show when the posts were published, so the time is only used to sort them
+	assert.NotNil(t, resp.Media[0].Metadata["created"])
+	assert.Equal(t, true, resp.Media[0].Metadata["created_synthetic"])
 }
 
 func TestFapello_QueryModel(t *testing.T) {
+	options := useCassette(t)
+
 	const NumberOfPosts = 98
 
-	extractor, _ := umd.New(nil).FindExtractor("https://fapello.com/darja-sobakinskaja/")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://fapello.com/darja-sobakinskaja/")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	err := resp.Error()
 
@@ -11,9 +11,19 @@ import (
 
 const BaseUrl = "https://imaglr.com/"
 
-var f = fetch.New(nil, 0)
+// defaultFetch is the Fetch instance shared by the extractors created without options.
+var defaultFetch = fetch.New(nil, 0)
 
-func getPost(id string) (*Post, error) {
+// newFetch returns the Fetch instance used by an extractor; extractors with options get their own instance.
+func newFetch(options []fetch.Option) *fetch.Fetch {
+	if len(options) == 0 {
+		return defaultFetch
+	}
+
+	return fetch.New(nil, 0, options...)
+}
+
+func getPost(f *fetch.Fetch, id string) (*Post, error) {
 	url := BaseUrl + fmt.Sprintf("post/%s", id)
 	html, err := f.GetText(url)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/samber/lo"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
 	"regexp"
@@ -18,12 +19,13 @@ type Imaglr struct {
 	source           model.SourceType
 	responseMetadata model.Metadata
 	external         model.External
+	fetch            *fetch.Fetch
 }
 
-func New(url string, metadata model.Metadata, external model.External) model.Extractor {
+func New(url string, metadata model.Metadata, external model.External, options ...fetch.Option) model.Extractor {
 	switch {
 	case utils.HasHost(url, "imaglr.com"):
-		return &Imaglr{Metadata: metadata, url: url, external: external}
+		return &Imaglr{Metadata: metadata, url: url, external: external, fetch: newFetch(options)}
 	}
 
 	return nil
@@ -154,7 +156,7 @@ func (i *Imaglr) fetchMedia(
 }
 
 func (i *Imaglr) fetchPost(source SourcePost) ([]Post, error) {
-	post, err := getPost(source.name)
+	post, err := getPost(i.fetch, source.name)
 
 	if err != nil {
 		return make([]Post, 0), err
@@ -181,6 +183,7 @@ func postsToMedia(posts []Post, sourceName string) []model.Media {
 			"name":    post.Author,
 			"source":  strings.ToLower(sourceName),
 			"created": post.Timestamp,
+			"page":    BaseUrl + "post/" + post.Id,
 		})
 	})
 }
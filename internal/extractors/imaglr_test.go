@@ -5,23 +5,27 @@ import (
 	"github.com/vegidio/umd-lib"
 	"github.com/vegidio/umd-lib/fetch"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestImaglr_DownloadVideo(t *testing.T) {
-	// Delete any previous file before continuing
-	const FilePath = "video.mp4"
-	_ = os.Remove(FilePath)
+	options := useCassette(t)
 
-	extractor, _ := umd.New(nil).FindExtractor("https://imaglr.com/post/5778297")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://imaglr.com/post/5778297")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	<-resp.Done
 
 	media := resp.Media[0]
-	f := fetch.New(nil, 0)
-	request, _ := f.NewRequest(media.Url, "video.mp4")
+	f := fetch.New(nil, 0, options...)
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	request, _ := f.NewRequest(media.Url, filePath)
 	downloadResponse := f.DownloadFile(request)
 
 	assert.NoError(t, downloadResponse.Error())
-	assert.Equal(t, int64(75_520_497), downloadResponse.Size)
+
+	// Large media bodies are truncated in the cassette, so the file has the size of the recorded body
+	info, _ := os.Stat(filePath)
+	assert.Positive(t, downloadResponse.Stats().Size)
+	assert.Equal(t, info.Size(), downloadResponse.Stats().Size)
 }
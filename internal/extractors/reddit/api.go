@@ -9,18 +9,29 @@ import (
 
 const BaseUrl = "https://www.reddit.com/"
 
-var f = fetch.New(nil, 10)
+// defaultFetch is the Fetch instance shared by the extractors created without options.
+var defaultFetch = fetch.New(nil, 10)
+
+// newFetch returns the Fetch instance used by an extractor; extractors with options get their own instance.
+func newFetch(options []fetch.Option) *fetch.Fetch {
+	if len(options) == 0 {
+		return defaultFetch
+	}
+
+	return fetch.New(nil, 10, options...)
+}
 
 // getSubmission fetches and processes submission data for a given Reddit post ID.
 //
 // Example: https://www.reddit.com/comments/1bxsmnr.json?raw_json=1, where <1bxsmnr> is the ID.
 //
 // # Parameters:
+//   - f: *fetch.Fetch - The Fetch instance used to send the requests
 //   - id: string - The unique identifier of the Reddit post to fetch
 //
 // # Returns:
 //   - <-chan model.Result[ChildData] - A receive-only channel that streams Reddit post data or errors
-func getSubmission(id string) <-chan model.Result[ChildData] {
+func getSubmission(f *fetch.Fetch, id string) <-chan model.Result[ChildData] {
 	out := make(chan model.Result[ChildData])
 
 	go func() {
@@ -62,13 +73,14 @@ func getSubmission(id string) <-chan model.Result[ChildData] {
 // <atomicbrunette18> is the username.
 //
 // # Parameters:
+//   - f: *fetch.Fetch - The Fetch instance used to send the requests
 //   - user: string - The username whose submissions to fetch
 //
 // # Returns:
 //   - <-chan model.Result[ChildData] - A receive-only channel that streams submission data or errors
-func getUserSubmissions(user string) <-chan model.Result[ChildData] {
+func getUserSubmissions(f *fetch.Fetch, user string) <-chan model.Result[ChildData] {
 	urlFmt := BaseUrl + "user/%s/submitted.json?sort=new&raw_json=1&after=%s&limit=%d"
-	return streamSubmissions(urlFmt, user)
+	return streamSubmissions(f, urlFmt, user)
 }
 
 // getSubredditSubmissions retrieves a stream of subreddit submissions as a channel of model.Result[ChildData]. The
@@ -77,16 +89,17 @@ func getUserSubmissions(user string) <-chan model.Result[ChildData] {
 // Example: https://www.reddit.com/r/nsfw/hot.json?raw_json=1&after=&limit=100, where <nsfw> is the subreddit name.
 //
 // # Parameters:
+//   - f: *fetch.Fetch - The Fetch instance used to send the requests.
 //   - subreddit: string - The subreddit whose submissions are to fetch.
 //
 // # Returns:
 //   - <-chan model.Result[ChildData] - A receive-only channel that streams submission data or errors.
-func getSubredditSubmissions(subreddit string) <-chan model.Result[ChildData] {
+func getSubredditSubmissions(f *fetch.Fetch, subreddit string) <-chan model.Result[ChildData] {
 	urlFmt := BaseUrl + "r/%s/hot.json?raw_json=1&after=%s&limit=%d"
-	return streamSubmissions(urlFmt, subreddit)
+	return streamSubmissions(f, urlFmt, subreddit)
 }
 
-func streamSubmissions(urlFmt string, what string) <-chan model.Result[ChildData] {
+func streamSubmissions(f *fetch.Fetch, urlFmt string, what string) <-chan model.Result[ChildData] {
 	out := make(chan model.Result[ChildData])
 
 	go func() {
@@ -140,9 +153,11 @@ func getGalleryData(child ChildData) []ChildData {
 			}
 
 			newChild := ChildData{
-				Author:  child.Author,
-				Url:     url,
-				Created: child.Created,
+				Id:        child.Id,
+				Permalink: child.Permalink,
+				Author:    child.Author,
+				Url:       url,
+				Created:   child.Created,
 			}
 
 			children = append(children, newChild)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/samber/lo"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
 	"regexp"
@@ -20,12 +21,13 @@ type Reddit struct {
 	source           model.SourceType
 	responseMetadata model.Metadata
 	external         model.External
+	fetch            *fetch.Fetch
 }
 
-func New(url string, metadata model.Metadata, external model.External) model.Extractor {
+func New(url string, metadata model.Metadata, external model.External, options ...fetch.Option) model.Extractor {
 	switch {
 	case utils.HasHost(url, Host):
-		return &Reddit{Metadata: metadata, url: url, external: external}
+		return &Reddit{Metadata: metadata, url: url, external: external, fetch: newFetch(options)}
 	}
 
 	return nil
@@ -143,11 +145,11 @@ func (r *Reddit) fetchMedia(
 
 		switch s := source.(type) {
 		case SourceSubmission:
-			children = getSubmission(s.Id)
+			children = getSubmission(r.fetch, s.Id)
 		case SourceUser:
-			children = getUserSubmissions(s.name)
+			children = getUserSubmissions(r.fetch, s.name)
 		case SourceSubreddit:
-			children = getSubredditSubmissions(s.name)
+			children = getSubredditSubmissions(r.fetch, s.name)
 		}
 
 		for child := range children {
@@ -187,6 +189,23 @@ func (r *Reddit) childToMedia(child ChildData, sourceName string, name string) [
 		"created": child.Created.Time,
 	})
 
+	if child.Id != "" {
+		newMedia.Metadata["id"] = child.Id
+	}
+
+	if child.Permalink != "" {
+		newMedia.Metadata["page"] = strings.TrimSuffix(BaseUrl, "/") + child.Permalink
+	}
+
+	// The fallback URL has no audio, so the streams are kept to be downloaded with Fetch.DownloadStream
+	if video := child.SecureMedia.RedditVideo; video.DashUrl != "" {
+		newMedia.Metadata["dash_url"] = video.DashUrl
+	}
+
+	if video := child.SecureMedia.RedditVideo; video.HlsUrl != "" {
+		newMedia.Metadata["hls_url"] = video.HlsUrl
+	}
+
 	return []model.Media{newMedia}
 }
 
@@ -16,6 +16,8 @@ type Child struct {
 }
 
 type ChildData struct {
+	Id            string                 `json:"id"`
+	Permalink     string                 `json:"permalink"`
 	Author        string                 `json:"author"`
 	Url           string                 `json:"url"`
 	Created       utils.EpochTime        `json:"created"`
@@ -40,4 +42,6 @@ type SecureMedia struct {
 
 type RedditVideo struct {
 	FallbackUrl string `json:"fallback_url"`
+	DashUrl     string `json:"dash_url"`
+	HlsUrl      string `json:"hls_url"`
 }
@@ -4,18 +4,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vegidio/umd-lib"
 	"github.com/vegidio/umd-lib/internal/model"
-	"os"
 	"testing"
 )
 
 func TestReddit_QuerySubreddit(t *testing.T) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		t.Skip("This test doesn't work when executed from GitHub Actions")
-	}
+	options := useCassette(t)
 
 	const NumberOfPosts = 50
 
-	extractor, _ := umd.New(nil).FindExtractor("https://www.reddit.com/r/PristineGirls/")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://www.reddit.com/r/PristineGirls/")
 	resp, _ := extractor.QueryMedia(NumberOfPosts, nil, true)
 	err := resp.Error()
 
@@ -26,13 +23,11 @@ func TestReddit_QuerySubreddit(t *testing.T) {
 }
 
 func TestReddit_QuerySubmissions(t *testing.T) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		t.Skip("This test doesn't work when executed from GitHub Actions")
-	}
+	options := useCassette(t)
 
 	const NumberOfPosts = 50
 
-	extractor, _ := umd.New(nil).FindExtractor("https://www.reddit.com/user/atomicbrunette18/")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://www.reddit.com/user/atomicbrunette18/")
 	resp, _ := extractor.QueryMedia(NumberOfPosts, nil, true)
 	err := resp.Error()
 
@@ -43,11 +38,9 @@ func TestReddit_QuerySubmissions(t *testing.T) {
 }
 
 func TestReddit_QuerySingleSubmission(t *testing.T) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		t.Skip("This test doesn't work when executed from GitHub Actions")
-	}
+	options := useCassette(t)
 
-	extractor, _ := umd.New(nil).FindExtractor("https://www.reddit.com/r/needysluts/comments/1aenk3e/if_im_wearing_this_for_our_date_you_have_bo/")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://www.reddit.com/r/needysluts/comments/1aenk3e/if_im_wearing_this_for_our_date_you_have_bo/")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	err := resp.Error()
 
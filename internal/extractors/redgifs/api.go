@@ -7,9 +7,19 @@ import (
 
 const BaseUrl = "https://api.redgifs.com/"
 
-var f = fetch.New(nil, 0)
+// defaultFetch is the Fetch instance shared by the extractors created without options.
+var defaultFetch = fetch.New(nil, 0)
 
-func getToken() (*Auth, error) {
+// newFetch returns the Fetch instance used by an extractor; extractors with options get their own instance.
+func newFetch(options []fetch.Option) *fetch.Fetch {
+	if len(options) == 0 {
+		return defaultFetch
+	}
+
+	return fetch.New(nil, 0, options...)
+}
+
+func getToken(f *fetch.Fetch) (*Auth, error) {
 	var auth *Auth
 	url := BaseUrl + "v2/auth/temporary"
 	headers := map[string]string{
@@ -29,7 +39,7 @@ func getToken() (*Auth, error) {
 	return auth, nil
 }
 
-func getGif(token string, videoUrl string, videoId string) (*GifResponse, error) {
+func getGif(f *fetch.Fetch, token string, videoUrl string, videoId string) (*GifResponse, error) {
 	var response *GifResponse
 	url := BaseUrl + fmt.Sprintf("v2/gifs/%s?views=yes", videoId)
 	headers := map[string]string{
@@ -48,7 +58,7 @@ func getGif(token string, videoUrl string, videoId string) (*GifResponse, error)
 	return response, nil
 }
 
-func getUser(token string, userUrl string, userName string, page int) (*UserResponse, error) {
+func getUser(f *fetch.Fetch, token string, userUrl string, userName string, page int) (*UserResponse, error) {
 	var response *UserResponse
 	url := BaseUrl + fmt.Sprintf("v2/users/%s/search?page=%d&count=100&order=latest&type=a&views=yes", userName, page)
 	headers := map[string]string{
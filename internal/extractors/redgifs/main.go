@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/samber/lo"
 	log "github.com/sirupsen/logrus"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/model"
 	"github.com/vegidio/umd-lib/internal/utils"
 	"math"
@@ -20,12 +21,13 @@ type Redgifs struct {
 	source           model.SourceType
 	responseMetadata model.Metadata
 	external         model.External
+	fetch            *fetch.Fetch
 }
 
-func New(url string, metadata model.Metadata, external model.External) model.Extractor {
+func New(url string, metadata model.Metadata, external model.External, options ...fetch.Option) model.Extractor {
 	switch {
 	case utils.HasHost(url, "redgifs.com"):
-		return &Redgifs{Metadata: metadata, url: url, external: external}
+		return &Redgifs{Metadata: metadata, url: url, external: external, fetch: newFetch(options)}
 	}
 
 	return nil
@@ -128,7 +130,7 @@ func (r *Redgifs) getNewOrSavedToken() (string, error) {
 	if !exists {
 		log.Debug("Issuing new RedGifs token")
 
-		auth, err := getToken()
+		auth, err := getToken(r.fetch)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err,
@@ -208,6 +210,7 @@ func (r *Redgifs) fetchGif(source SourceVideo, token string) <-chan model.Result
 		defer close(result)
 
 		response, err := getGif(
+			r.fetch,
 			fmt.Sprintf("Bearer %s", token),
 			fmt.Sprintf("https://www.redgifs.com/watch/%s", source.name),
 			source.name,
@@ -232,7 +235,7 @@ func (r *Redgifs) fetchUser(source SourceUser, token string, limit int) <-chan m
 
 		bearer := fmt.Sprintf("Bearer %s", token)
 		url := fmt.Sprintf("https://www.redgifs.com/users/%s", source.name)
-		response, err := getUser(bearer, url, source.name, 1)
+		response, err := getUser(r.fetch, bearer, url, source.name, 1)
 
 		if err != nil {
 			result <- model.Result[[]Gif]{Err: err}
@@ -244,7 +247,7 @@ func (r *Redgifs) fetchUser(source SourceUser, token string, limit int) <-chan m
 		numPages := int(math.Min(float64(response.Pages), maxPages))
 
 		for i := 2; i <= numPages; i++ {
-			response, err = getUser(bearer, url, source.name, i)
+			response, err = getUser(r.fetch, bearer, url, source.name, i)
 			if err != nil {
 				result <- model.Result[[]Gif]{Err: err}
 				return
@@ -273,6 +276,7 @@ func videosToMedia(gifs []Gif, sourceName string) []model.Media {
 			"source":  strings.ToLower(sourceName),
 			"created": gif.Created.Time,
 			"id":      gif.Id,
+			"page":    "https://www.redgifs.com/watch/" + strings.ToLower(gif.Id),
 		})
 	})
 }
@@ -7,32 +7,38 @@ import (
 	"github.com/vegidio/umd-lib"
 	"github.com/vegidio/umd-lib/fetch"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
 func TestRedGifs_DownloadVideo(t *testing.T) {
-	// Delete any previous file before continuing
-	const FilePath = "video.mp4"
-	_ = os.Remove(FilePath)
+	options := useCassette(t)
 
-	extractor, _ := umd.New(nil).FindExtractor("https://www.redgifs.com/watch/sturdycuddlyicefish")
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://www.redgifs.com/watch/sturdycuddlyicefish")
 	resp, _ := extractor.QueryMedia(99999, nil, true)
 	<-resp.Done
 
 	media := resp.Media[0]
-	f := fetch.New(nil, 0)
-	request, _ := f.NewRequest(media.Url, "video.mp4")
+	f := fetch.New(nil, 0, options...)
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	request, _ := f.NewRequest(media.Url, filePath)
 	downloadResponse := f.DownloadFile(request)
 
 	assert.NoError(t, downloadResponse.Error())
-	assert.Equal(t, int64(15_212_770), downloadResponse.Size)
+
+	// Large media bodies are truncated in the cassette, so the file has the size of the recorded body
+	info, _ := os.Stat(filePath)
+	assert.Positive(t, downloadResponse.Stats().Size)
+	assert.Equal(t, info.Size(), downloadResponse.Stats().Size)
 	assert.Equal(t, "sturdycuddlyicefish", media.Metadata["id"])
 	assert.Equal(t, "sonya_18yo", media.Metadata["name"])
 }
 
 func TestRedGifs_FetchUser(t *testing.T) {
-	extractor, _ := umd.New(nil).FindExtractor("https://www.redgifs.com/users/atomicbrunette18")
+	options := useCassette(t)
+
+	extractor, _ := umd.New(nil, options...).FindExtractor("https://www.redgifs.com/users/atomicbrunette18")
 	resp, _ := extractor.QueryMedia(180, nil, true)
 	err := resp.Error()
 
@@ -43,19 +49,21 @@ func TestRedGifs_FetchUser(t *testing.T) {
 }
 
 func TestRedGifs_ReuseToken(t *testing.T) {
+	options := useCassette(t)
+
 	// Create a buffer and redirect global log output to it
 	var buf bytes.Buffer
 	log.SetOutput(&buf)
 	log.SetLevel(log.DebugLevel)
 
 	// First query
-	u := umd.New(nil)
+	u := umd.New(nil, options...)
 	extractor, _ := u.FindExtractor("https://www.redgifs.com/watch/sturdycuddlyicefish")
 	r1, _ := extractor.QueryMedia(99999, nil, true)
 	<-r1.Done
 
 	// Second query
-	u = umd.New(r1.Metadata)
+	u = umd.New(r1.Metadata, options...)
 	extractor, _ = u.FindExtractor("https://www.redgifs.com/watch/ecstaticthickasiansmallclawedotter")
 	r2, _ := extractor.QueryMedia(99999, nil, true)
 	<-r2.Done
@@ -2,6 +2,7 @@ package umd
 
 import (
 	"fmt"
+	"github.com/vegidio/umd-lib/fetch"
 	"github.com/vegidio/umd-lib/internal/extractors/coomer"
 	"github.com/vegidio/umd-lib/internal/extractors/fapello"
 	"github.com/vegidio/umd-lib/internal/extractors/imaglr"
@@ -13,21 +14,23 @@ import (
 // Umd represents a Universal Media Downloader instance.
 type Umd struct {
 	metadata model.Metadata
+	options  []fetch.Option
 }
 
 // New creates a new instance of Umd.
 //
 // # Parameters:
 //   - metadata: A map containing metadata information.
+//   - options: Optional settings of the Fetch instances used by the extractors, like fetch.WithTransport.
 //
 // # Returns:
 //   - Umd: A new instance of Umd.
-func New(metadata model.Metadata) Umd {
+func New(metadata model.Metadata, options ...fetch.Option) Umd {
 	if metadata == nil {
 		metadata = make(model.Metadata)
 	}
 
-	return Umd{metadata: metadata}
+	return Umd{metadata: metadata, options: options}
 }
 
 // FindExtractor attempts to find a suitable extractor for the given URL.
@@ -40,12 +43,12 @@ func New(metadata model.Metadata) Umd {
 //   - error: An error if no suitable extractor is found.
 func (u Umd) FindExtractor(url string) (model.Extractor, error) {
 	var extractor model.Extractor
-	extractors := []func(string, model.Metadata, model.External) model.Extractor{
+	extractors := []func(string, model.Metadata, model.External, ...fetch.Option) model.Extractor{
 		coomer.New, fapello.New, imaglr.New, reddit.New, redgifs.New,
 	}
 
 	for _, newExtractor := range extractors {
-		if e := newExtractor(url, u.metadata, External{}); e != nil {
+		if e := newExtractor(url, u.metadata, External{options: u.options}, u.options...); e != nil {
 			extractor = e
 			break
 		}
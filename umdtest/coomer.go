@@ -0,0 +1,159 @@
+package umdtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Coomer is the builder of the fake Coomer, or Kemono, that serves the posts of the users in the API v1.
+type Coomer struct {
+	server *Server
+	host   string
+	posts  []CoomerPost
+}
+
+// CoomerPost is a post in the fake Coomer, or Kemono.
+type CoomerPost struct {
+	// Id is the ID of the post.
+	Id string
+
+	// Service is the service where the post was published, like "onlyfans" or "patreon".
+	Service string
+
+	// User is the ID of the user that published the post.
+	User string
+
+	// Published is the time when the post was published.
+	Published time.Time
+
+	// Images are the images in the post, listed in the API as previews.
+	Images []File
+
+	// Attachments are the other files in the post, like videos.
+	Attachments []File
+}
+
+// coomerPageSize is the number of posts in each page of the API.
+const coomerPageSize = 50
+
+var regexCoomerPosts = regexp.MustCompile(`^/api/v1/([^/]+)/user/([^/]+)/posts$`)
+var regexCoomerPost = regexp.MustCompile(`^/api/v1/([^/]+)/user/([^/]+)/post/([^/]+)$`)
+
+type coomerFile struct {
+	Server string `json:"server"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+}
+
+// AddPost adds a post to the fake site. The files are saved in paths with the SHA-256 hash of their content, and served
+// by all file servers (n1 to n4) and the main host, like in the real site; the API always lists them in n1.
+//
+// # Parameters:
+//   - post: the post.
+//
+// # Returns:
+//   - The URLs of the images and then the attachments of the post.
+func (c *Coomer) AddPost(post CoomerPost) []string {
+	urls := make([]string, 0, len(post.Images)+len(post.Attachments))
+	for _, file := range append(append([]File{}, post.Images...), post.Attachments...) {
+		filePath := coomerFilePath(file)
+		for i := 1; i <= 4; i++ {
+			c.server.AddFile(fmt.Sprintf("https://n%d.%s/data%s", i, c.host, filePath), file.Content)
+		}
+
+		c.server.AddFile("https://"+c.host+"/data"+filePath, file.Content)
+		urls = append(urls, c.fileServer()+"/data"+filePath)
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	c.posts = append(c.posts, post)
+	return urls
+}
+
+// region - Private methods
+
+func (c *Coomer) handle(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	c.server.mu.Lock()
+	posts := append([]CoomerPost{}, c.posts...)
+	c.server.mu.Unlock()
+
+	if matches := regexCoomerPost.FindStringSubmatch(u.Path); matches != nil {
+		for _, post := range posts {
+			if post.Service == matches[1] && post.User == matches[2] && post.Id == matches[3] {
+				writeJSON(w, map[string]any{
+					"post":        coomerPostData(post),
+					"previews":    c.files(post.Images),
+					"attachments": c.files(post.Attachments),
+				})
+				return
+			}
+		}
+
+		http.NotFound(w, req)
+		return
+	}
+
+	matches := regexCoomerPosts.FindStringSubmatch(u.Path)
+	if matches == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	userPosts := make([]map[string]any, 0)
+	for _, post := range posts {
+		if post.Service == matches[1] && post.User == matches[2] {
+			userPosts = append(userPosts, coomerPostData(post))
+		}
+	}
+
+	offset, _ := strconv.Atoi(u.Query().Get("o"))
+	offset = min(max(offset, 0), len(userPosts))
+	end := min(offset+coomerPageSize, len(userPosts))
+
+	writeJSON(w, userPosts[offset:end])
+}
+
+func (c *Coomer) files(files []File) []coomerFile {
+	result := make([]coomerFile, 0, len(files))
+	for _, file := range files {
+		result = append(result, coomerFile{Server: c.fileServer(), Name: file.Name, Path: coomerFilePath(file)})
+	}
+
+	return result
+}
+
+func (c *Coomer) fileServer() string {
+	return "https://n1." + c.host
+}
+
+// endregion
+
+// region - Private functions
+
+func coomerPostData(post CoomerPost) map[string]any {
+	return map[string]any{
+		"id":        post.Id,
+		"service":   post.Service,
+		"user":      post.User,
+		"published": post.Published.UTC().Format("2006-01-02T15:04:05"),
+	}
+}
+
+// coomerFilePath returns the path of a file, like /ab/cd/<sha256>.jpg.
+func coomerFilePath(file File) string {
+	sum := sha256.Sum256(file.Content)
+	hash := hex.EncodeToString(sum[:])
+
+	return fmt.Sprintf("/%s/%s/%s%s", hash[0:2], hash[2:4], hash, path.Ext(file.Name))
+}
+
+// endregion
@@ -0,0 +1,142 @@
+package umdtest
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Fapello is the builder of the fake Fapello, that serves the HTML pages of the models, their pagination and posts.
+type Fapello struct {
+	server *Server
+	posts  []FapelloPost
+}
+
+// FapelloPost is a post in the fake Fapello.
+type FapelloPost struct {
+	// Model is the name of the model, like "jessica-alba".
+	Model string
+
+	// Id is the number of the post.
+	Id int
+
+	// File is the image or video in the post.
+	File File
+}
+
+// fapelloPageSize is the number of posts in each page of a model.
+const fapelloPageSize = 32
+
+var regexFapelloPage = regexp.MustCompile(`^/ajax/model/([^/]+)/page-(\d+)/?$`)
+var regexFapelloPost = regexp.MustCompile(`^/([^/]+)/(\d+)/?$`)
+var regexFapelloModel = regexp.MustCompile(`^/([^/]+)/?$`)
+
+// AddPost adds a post to the fake Fapello.
+//
+// # Parameters:
+//   - post: the post.
+//
+// # Returns:
+//   - The URL of the media in the post.
+func (f *Fapello) AddPost(post FapelloPost) string {
+	fileUrl := fapelloFileUrl(post)
+	f.server.AddFile(fileUrl, post.File.Content)
+
+	f.server.mu.Lock()
+	defer f.server.mu.Unlock()
+
+	f.posts = append(f.posts, post)
+	return fileUrl
+}
+
+// region - Private methods
+
+func (f *Fapello) handle(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	f.server.mu.Lock()
+	posts := append([]FapelloPost{}, f.posts...)
+	f.server.mu.Unlock()
+
+	switch {
+	case regexFapelloPage.MatchString(u.Path):
+		matches := regexFapelloPage.FindStringSubmatch(u.Path)
+		page, _ := strconv.Atoi(matches[2])
+		modelPosts := fapelloModelPosts(posts, matches[1])
+
+		start := min(max(page-1, 0)*fapelloPageSize, len(modelPosts))
+		end := min(start+fapelloPageSize, len(modelPosts))
+
+		var sb strings.Builder
+		for _, post := range modelPosts[start:end] {
+			postUrl := fmt.Sprintf("https://fapello.com/%s/%d/", post.Model, post.Id)
+			sb.WriteString(fmt.Sprintf(`<div><a href="%s"><img class="w-full h-full object-cover" src="%s"></a></div>`,
+				html.EscapeString(postUrl), html.EscapeString(fapelloFileUrl(post))))
+		}
+
+		writeHTML(w, sb.String())
+
+	case regexFapelloPost.MatchString(u.Path):
+		matches := regexFapelloPost.FindStringSubmatch(u.Path)
+		id, _ := strconv.Atoi(matches[2])
+
+		for _, post := range fapelloModelPosts(posts, matches[1]) {
+			if post.Id == id {
+				writeHTML(w, fapelloPostPage(post))
+				return
+			}
+		}
+
+		http.NotFound(w, req)
+
+	case regexFapelloModel.MatchString(u.Path):
+		matches := regexFapelloModel.FindStringSubmatch(u.Path)
+		modelPosts := fapelloModelPosts(posts, matches[1])
+		if len(modelPosts) == 0 {
+			http.NotFound(w, req)
+			return
+		}
+
+		pages := (len(modelPosts) + fapelloPageSize - 1) / fapelloPageSize
+		writeHTML(w, fmt.Sprintf(`<html><body><h2>%s</h2><div id="content"></div>`+
+			`<div id="showmore" data-page="1" data-max="%d"></div></body></html>`, html.EscapeString(matches[1]), pages))
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// endregion
+
+// region - Private functions
+
+func fapelloModelPosts(posts []FapelloPost, model string) []FapelloPost {
+	modelPosts := make([]FapelloPost, 0)
+	for _, post := range posts {
+		if strings.EqualFold(post.Model, model) {
+			modelPosts = append(modelPosts, post)
+		}
+	}
+
+	return modelPosts
+}
+
+func fapelloPostPage(post FapelloPost) string {
+	fileUrl := html.EscapeString(fapelloFileUrl(post))
+
+	if isVideo(post.File.Name) {
+		return fmt.Sprintf(`<html><body><video class="uk-align-center" controls>`+
+			`<source src="%s" type="video/mp4"></video></body></html>`, fileUrl)
+	}
+
+	return fmt.Sprintf(`<html><body><div class="flex justify-between items-center">`+
+		`<a href="%s" target="_blank"><img src="%s"></a></div></body></html>`, fileUrl, fileUrl)
+}
+
+func fapelloFileUrl(post FapelloPost) string {
+	return fmt.Sprintf("https://fapello.com/content/%s/%d/%s", post.Model, post.Id, post.File.Name)
+}
+
+// endregion
@@ -0,0 +1,106 @@
+package umdtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Imaglr is the builder of the fake Imaglr, that serves the HTML pages of the posts.
+type Imaglr struct {
+	server *Server
+	posts  map[string]ImaglrPost
+}
+
+// ImaglrPost is a post in the fake Imaglr.
+type ImaglrPost struct {
+	// Id is the ID of the post, like "5778297".
+	Id string
+
+	// Author is the name of the user that published the post.
+	Author string
+
+	// Created is the time when the post was published.
+	Created time.Time
+
+	// File is the image or video in the post.
+	File File
+}
+
+var regexImaglrPost = regexp.MustCompile(`^/post/([^/]+)/?$`)
+
+// AddPost adds a post to the fake Imaglr.
+//
+// # Parameters:
+//   - post: the post.
+//
+// # Returns:
+//   - The URL of the media in the post.
+func (i *Imaglr) AddPost(post ImaglrPost) string {
+	fileUrl := imaglrFileUrl(post)
+	i.server.AddFile(fileUrl, post.File.Content)
+
+	i.server.mu.Lock()
+	defer i.server.mu.Unlock()
+
+	i.posts[post.Id] = post
+	return fileUrl
+}
+
+// region - Private methods
+
+func (i *Imaglr) handle(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	matches := regexImaglrPost.FindStringSubmatch(u.Path)
+	if matches == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	i.server.mu.Lock()
+	post, exists := i.posts[matches[1]]
+	i.server.mu.Unlock()
+
+	if !exists {
+		http.NotFound(w, req)
+		return
+	}
+
+	page, _ := json.Marshal(map[string]any{
+		"component": "Post/Show",
+		"props": map[string]any{
+			"post": map[string]any{
+				"data": map[string]any{
+					"id":                   post.Id,
+					"created_at_timestamp": epoch(post.Created),
+				},
+			},
+		},
+	})
+
+	fileUrl := html.EscapeString(imaglrFileUrl(post))
+	mediaType, mediaTag := "image", "og:image"
+	if isVideo(post.File.Name) {
+		mediaType, mediaTag = "video", "og:video"
+	}
+
+	writeHTML(w, fmt.Sprintf(`<html><head>`+
+		`<meta name="author" content="%s">`+
+		`<meta property="og:type" content="%s">`+
+		`<meta property="%s" content="%s">`+
+		`</head><body><div id="app" data-page="%s"></div></body></html>`,
+		html.EscapeString(post.Author), mediaType, mediaTag, fileUrl, html.EscapeString(string(page))))
+}
+
+// endregion
+
+// region - Private functions
+
+func imaglrFileUrl(post ImaglrPost) string {
+	return fmt.Sprintf("https://cdn.imaglr.com/posts/%s/%s", post.Id, post.File.Name)
+}
+
+// endregion
@@ -0,0 +1,180 @@
+package umdtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reddit is the builder of the fake Reddit, that serves subreddit and user listings, and the submission of each post.
+type Reddit struct {
+	server *Server
+	posts  []RedditPost
+}
+
+// RedditPost is a submission in the fake Reddit.
+type RedditPost struct {
+	// Id is the ID of the submission, like "1bxsmnr".
+	Id string
+
+	// Subreddit is the name of the subreddit where the post was submitted.
+	Subreddit string
+
+	// Author is the name of the user that submitted the post.
+	Author string
+
+	// Created is the time when the post was submitted.
+	Created time.Time
+
+	// Files are the media in the post; posts with more than one file are galleries, and videos are served by v.redd.it.
+	Files []File
+}
+
+var regexRedditListing = regexp.MustCompile(`^/(r|user)/([^/]+)/(hot|submitted)\.json$`)
+var regexRedditSubmission = regexp.MustCompile(`^/comments/([^/]+)\.json$`)
+
+// AddPost adds a submission to the fake Reddit.
+//
+// # Parameters:
+//   - post: the submission.
+//
+// # Returns:
+//   - The URLs of the media in the post, in the same order of the files.
+func (r *Reddit) AddPost(post RedditPost) []string {
+	urls := make([]string, 0, len(post.Files))
+	for _, file := range post.Files {
+		fileUrl := redditFileUrl(post.Id, file)
+		r.server.AddFile(fileUrl, file.Content)
+		urls = append(urls, fileUrl)
+	}
+
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	r.posts = append(r.posts, post)
+	return urls
+}
+
+// region - Private methods
+
+func (r *Reddit) handle(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	r.server.mu.Lock()
+	posts := append([]RedditPost{}, r.posts...)
+	r.server.mu.Unlock()
+
+	if matches := regexRedditSubmission.FindStringSubmatch(u.Path); matches != nil {
+		for _, post := range posts {
+			if post.Id == matches[1] {
+				writeJSON(w, []any{redditListing([]RedditPost{post}, ""), redditListing(nil, "")})
+				return
+			}
+		}
+
+		http.NotFound(w, req)
+		return
+	}
+
+	matches := regexRedditListing.FindStringSubmatch(u.Path)
+	if matches == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	filtered := make([]RedditPost, 0)
+	for _, post := range posts {
+		if (matches[1] == "r" && strings.EqualFold(post.Subreddit, matches[2])) ||
+			(matches[1] == "user" && strings.EqualFold(post.Author, matches[2])) {
+			filtered = append(filtered, post)
+		}
+	}
+
+	// The listing continues after the post whose fullname is in the parameter "after"
+	start := 0
+	after := u.Query().Get("after")
+	for i, post := range filtered {
+		if "t3_"+post.Id == after {
+			start = i + 1
+		}
+	}
+
+	limit, err := strconv.Atoi(u.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 25
+	}
+
+	end := min(start+limit, len(filtered))
+	next := ""
+	if end < len(filtered) {
+		next = "t3_" + filtered[end-1].Id
+	}
+
+	writeJSON(w, redditListing(filtered[start:end], next))
+}
+
+// endregion
+
+// region - Private functions
+
+func redditListing(posts []RedditPost, after string) map[string]any {
+	children := make([]any, 0, len(posts))
+	for _, post := range posts {
+		children = append(children, map[string]any{"kind": "t3", "data": redditPostData(post)})
+	}
+
+	return map[string]any{
+		"kind": "Listing",
+		"data": map[string]any{"after": after, "children": children},
+	}
+}
+
+func redditPostData(post RedditPost) map[string]any {
+	data := map[string]any{
+		"id":        post.Id,
+		"name":      "t3_" + post.Id,
+		"subreddit": post.Subreddit,
+		"author":    post.Author,
+		"created":   float64(epoch(post.Created)),
+		"permalink": fmt.Sprintf("/r/%s/comments/%s/", post.Subreddit, post.Id),
+	}
+
+	switch {
+	case len(post.Files) > 1:
+		metadata := make(map[string]any)
+		for i, file := range post.Files {
+			metadata[fmt.Sprintf("media%d", i)] = map[string]any{
+				"status": "valid",
+				"s":      map[string]any{"u": redditFileUrl(post.Id, file)},
+			}
+		}
+
+		data["is_gallery"] = true
+		data["media_metadata"] = metadata
+		data["url"] = "https://www.reddit.com/gallery/" + post.Id
+
+	case len(post.Files) == 1 && isVideo(post.Files[0].Name):
+		data["url"] = "https://v.redd.it/" + post.Id
+		data["secure_media"] = map[string]any{
+			"reddit_video": map[string]any{"fallback_url": redditFileUrl(post.Id, post.Files[0])},
+		}
+
+	case len(post.Files) == 1:
+		data["url"] = redditFileUrl(post.Id, post.Files[0])
+	}
+
+	return data
+}
+
+// redditFileUrl returns the URL of a file in a post; images are served by i.redd.it, and videos by v.redd.it.
+func redditFileUrl(id string, file File) string {
+	if isVideo(file.Name) {
+		return fmt.Sprintf("https://v.redd.it/%s/%s", id, file.Name)
+	}
+
+	return "https://i.redd.it/" + file.Name
+}
+
+// endregion
@@ -0,0 +1,147 @@
+package umdtest
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedGifs is the builder of the fake RedGifs, that serves temporary tokens, gifs and the gifs of the users. Requests
+// without the temporary token fail with the status 401.
+type RedGifs struct {
+	server *Server
+	token  string
+	gifs   []RedGif
+}
+
+// RedGif is a video in the fake RedGifs.
+type RedGif struct {
+	// Id is the ID of the video, like "sneakyfakeanimal".
+	Id string
+
+	// User is the name of the user that published the video.
+	User string
+
+	// Created is the time when the video was published.
+	Created time.Time
+
+	// Duration is the duration of the video, in seconds.
+	Duration float64
+
+	// File is the video, served as the HD version.
+	File File
+}
+
+// redGifsPageSize is the maximum number of gifs in each page of the users' search.
+const redGifsPageSize = 100
+
+var regexRedGifsGif = regexp.MustCompile(`^/v2/gifs/([^/]+)$`)
+var regexRedGifsUser = regexp.MustCompile(`^/v2/users/([^/]+)/search$`)
+
+// AddGif adds a video to the fake RedGifs.
+//
+// # Parameters:
+//   - gif: the video.
+//
+// # Returns:
+//   - The URL of the video.
+func (r *RedGifs) AddGif(gif RedGif) string {
+	fileUrl := redGifsFileUrl(gif)
+	r.server.AddFile(fileUrl, gif.File.Content)
+
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	r.gifs = append(r.gifs, gif)
+	return fileUrl
+}
+
+// Token returns the temporary token given by the fake RedGifs.
+func (r *RedGifs) Token() string {
+	return r.token
+}
+
+// region - Private methods
+
+func (r *RedGifs) handle(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	if u.Path == "/v2/auth/temporary" {
+		writeJSON(w, map[string]any{"token": r.token, "session": "umdtest-session"})
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer "+r.token {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	r.server.mu.Lock()
+	gifs := append([]RedGif{}, r.gifs...)
+	r.server.mu.Unlock()
+
+	if matches := regexRedGifsGif.FindStringSubmatch(u.Path); matches != nil {
+		for _, gif := range gifs {
+			if strings.EqualFold(gif.Id, matches[1]) {
+				writeJSON(w, map[string]any{"gif": redGifsGifData(gif)})
+				return
+			}
+		}
+
+		http.NotFound(w, req)
+		return
+	}
+
+	matches := regexRedGifsUser.FindStringSubmatch(u.Path)
+	if matches == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	userGifs := make([]map[string]any, 0)
+	for _, gif := range gifs {
+		if strings.EqualFold(gif.User, matches[1]) {
+			userGifs = append(userGifs, redGifsGifData(gif))
+		}
+	}
+
+	page, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pages := (len(userGifs) + redGifsPageSize - 1) / redGifsPageSize
+	start := min((page-1)*redGifsPageSize, len(userGifs))
+	end := min(start+redGifsPageSize, len(userGifs))
+
+	writeJSON(w, map[string]any{
+		"page":  page,
+		"pages": pages,
+		"total": len(userGifs),
+		"gifs":  userGifs[start:end],
+	})
+}
+
+// endregion
+
+// region - Private functions
+
+func redGifsGifData(gif RedGif) map[string]any {
+	return map[string]any{
+		"id":         gif.Id,
+		"userName":   gif.User,
+		"duration":   gif.Duration,
+		"createDate": epoch(gif.Created),
+		"urls": map[string]any{
+			"hd":     redGifsFileUrl(gif),
+			"poster": "https://media.redgifs.com/" + gif.Id + "-poster.jpg",
+		},
+	}
+}
+
+func redGifsFileUrl(gif RedGif) string {
+	return "https://media.redgifs.com/" + gif.File.Name
+}
+
+// endregion
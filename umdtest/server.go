@@ -0,0 +1,339 @@
+// Package umdtest has fake versions of the sites supported by umd, to test code that uses umd without the network.
+//
+// A Server emulates the endpoints used by the extractors, with the users, posts and media added with its builders:
+//
+//	server := umdtest.Start(t)
+//	server.Reddit().AddPost(umdtest.RedditPost{Id: "abc", Subreddit: "pics", Author: "user", Files: ...})
+//
+//	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://www.reddit.com/r/pics/")
+//
+// Every request sent by an umd or fetch instance created with the Server's Options goes to it instead of the network,
+// no matter the host in the URL; other instances are not affected, so tests using different Servers can run in
+// parallel. Errors and rate limits can be injected with FailRequests and RateLimit.
+package umdtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vegidio/umd-lib/fetch"
+)
+
+// File is a media file served by the Server, like an image or a video.
+type File struct {
+	// Name is the name of the file, like "photo.jpg"; its extension defines the type of media.
+	Name string
+
+	// Content is the content of the file.
+	Content []byte
+}
+
+// Server is a fake of all the sites supported by umd.
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	faults   []*fault
+	requests []string
+
+	reddit  *Reddit
+	coomer  *Coomer
+	kemono  *Coomer
+	redgifs *RedGifs
+	fapello *Fapello
+	imaglr  *Imaglr
+}
+
+// fault is an error injected in the requests whose URL contains a text.
+type fault struct {
+	match      string
+	statusCode int
+	retryAfter time.Duration
+	// remaining is the number of requests that still fail; -1 means all of them
+	remaining int
+}
+
+// NewServer creates and starts a Server. It's only used by the umd and fetch instances created with its Options.
+func NewServer() *Server {
+	s := &Server{
+		files:    make(map[string][]byte),
+		faults:   make([]*fault, 0),
+		requests: make([]string, 0),
+	}
+
+	s.reddit = &Reddit{server: s, posts: make([]RedditPost, 0)}
+	s.coomer = &Coomer{server: s, host: "coomer.st", posts: make([]CoomerPost, 0)}
+	s.kemono = &Coomer{server: s, host: "kemono.cr", posts: make([]CoomerPost, 0)}
+	s.redgifs = &RedGifs{server: s, token: "umdtest-token", gifs: make([]RedGif, 0)}
+	s.fapello = &Fapello{server: s, posts: make([]FapelloPost, 0)}
+	s.imaglr = &Imaglr{server: s, posts: make(map[string]ImaglrPost)}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Start creates a Server that runs until the end of the test.
+//
+// # Parameters:
+//   - t: the test; the Server is closed when it finishes.
+func Start(t testing.TB) *Server {
+	s := NewServer()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Options returns the options that make an umd or fetch instance send all its requests to this Server, instead of the
+// network. The host limits of the supported sites are removed, since the Server doesn't need to be protected; limits
+// can still be set with fetch.WithHostLimit after these options.
+//
+//	extractor, _ := umd.New(nil, server.Options()...).FindExtractor(url)
+//	f := fetch.New(nil, 0, server.Options()...)
+func (s *Server) Options() []fetch.Option {
+	options := []fetch.Option{fetch.WithTransport(&redirectTransport{target: s.server.URL})}
+	for host := range fetch.DefaultHostLimits {
+		options = append(options, fetch.WithHostLimit(host, fetch.HostLimit{}))
+	}
+
+	return options
+}
+
+// Close stops the Server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the address of the Server, like "http://127.0.0.1:1234".
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Reddit returns the builder of the fake Reddit.
+func (s *Server) Reddit() *Reddit {
+	return s.reddit
+}
+
+// Coomer returns the builder of the fake Coomer.
+func (s *Server) Coomer() *Coomer {
+	return s.coomer
+}
+
+// Kemono returns the builder of the fake Kemono, which has the same API as Coomer.
+func (s *Server) Kemono() *Coomer {
+	return s.kemono
+}
+
+// RedGifs returns the builder of the fake RedGifs.
+func (s *Server) RedGifs() *RedGifs {
+	return s.redgifs
+}
+
+// Fapello returns the builder of the fake Fapello.
+func (s *Server) Fapello() *Fapello {
+	return s.fapello
+}
+
+// Imaglr returns the builder of the fake Imaglr.
+func (s *Server) Imaglr() *Imaglr {
+	return s.imaglr
+}
+
+// AddFile serves the content in the URL, like the URL of a media file.
+//
+// # Parameters:
+//   - fileUrl: the full URL of the file, like "https://i.redd.it/photo.jpg".
+//   - content: the content of the file.
+func (s *Server) AddFile(fileUrl string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[normalizeUrl(fileUrl)] = content
+}
+
+// FailRequests makes the requests whose URL contains the text fail with the status code.
+//
+// # Parameters:
+//   - match: a text in the URL of the requests, like "/api/v1/" or "redgifs.com".
+//   - statusCode: the status code of the responses, like 500.
+//   - times: the number of requests that fail; zero or less fails all of them.
+func (s *Server) FailRequests(match string, statusCode int, times int) {
+	s.addFault(&fault{match: match, statusCode: statusCode}, times)
+}
+
+// RateLimit makes the requests whose URL contains the text fail with the status 429, and a Retry-After header.
+//
+// # Parameters:
+//   - match: a text in the URL of the requests, like "reddit.com".
+//   - retryAfter: the wait sent in the Retry-After header.
+//   - times: the number of requests that are limited; zero or less limits all of them.
+func (s *Server) RateLimit(match string, retryAfter time.Duration, times int) {
+	s.addFault(&fault{match: match, statusCode: http.StatusTooManyRequests, retryAfter: retryAfter}, times)
+}
+
+// Requests returns the URLs of all the requests received by the Server, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+// region - Private functions
+
+func (s *Server) addFault(f *fault, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f.remaining = times
+	if times <= 0 {
+		f.remaining = -1
+	}
+
+	s.faults = append(s.faults, f)
+}
+
+// takeFault returns the fault that applies to the URL, if any, counting it as used.
+func (s *Server) takeFault(requestUrl string) *fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.faults {
+		if f.remaining != 0 && strings.Contains(requestUrl, f.match) {
+			if f.remaining > 0 {
+				f.remaining--
+			}
+
+			return f
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	// The original host is kept in the request, and the path may have duplicated slashes, like Fapello's
+	u := &url.URL{Scheme: "https", Host: r.Host, Path: cleanPath(r.URL.Path), RawQuery: r.URL.RawQuery}
+	requestUrl := u.String()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, requestUrl)
+	content, isFile := s.files[normalizeUrl(requestUrl)]
+	s.mu.Unlock()
+
+	if f := s.takeFault(requestUrl); f != nil {
+		if f.retryAfter > 0 {
+			w.Header().Set("Retry-After", fmt.Sprintf("%g", f.retryAfter.Seconds()))
+		}
+
+		http.Error(w, http.StatusText(f.statusCode), f.statusCode)
+		return
+	}
+
+	if isFile {
+		http.ServeContent(w, r, u.Path, time.Time{}, strings.NewReader(string(content)))
+		return
+	}
+
+	host := u.Hostname()
+	switch {
+	case matchesHost(host, "reddit.com"):
+		s.reddit.handle(w, r, u)
+	case matchesHost(host, "coomer.st"), matchesHost(host, "coomer.party"):
+		s.coomer.handle(w, r, u)
+	case matchesHost(host, "kemono.cr"), matchesHost(host, "kemono.party"):
+		s.kemono.handle(w, r, u)
+	case matchesHost(host, "redgifs.com"):
+		s.redgifs.handle(w, r, u)
+	case matchesHost(host, "fapello.com"):
+		s.fapello.handle(w, r, u)
+	case matchesHost(host, "imaglr.com"):
+		s.imaglr.handle(w, r, u)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// redirectTransport sends all requests to the Server, keeping the original host in the Host header.
+type redirectTransport struct {
+	target string
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(t.target)
+	if err != nil {
+		return nil, err
+	}
+
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme = target.Scheme
+	redirected.URL.Host = target.Host
+	redirected.Host = req.URL.Host
+
+	return http.DefaultTransport.RoundTrip(redirected)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeHTML(w http.ResponseWriter, html string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(html))
+}
+
+// epoch returns the Unix time of t; the zero time is returned as the epoch, because the sites don't send negative
+// times.
+func epoch(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// isVideo returns true if the name of the file has the extension of a video.
+func isVideo(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".m4v", ".mkv", ".mov", ".mp4", ".webm":
+		return true
+	default:
+		return false
+	}
+}
+
+func matchesHost(host string, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// cleanPath removes duplicated slashes from the path.
+func cleanPath(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	return path
+}
+
+// normalizeUrl makes URLs that differ only in the scheme, or in duplicated slashes, the same.
+func normalizeUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	return u.Host + cleanPath(u.Path) + "?" + u.RawQuery
+}
+
+// endregion
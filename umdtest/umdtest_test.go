@@ -0,0 +1,258 @@
+package umdtest_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vegidio/umd-lib"
+	"github.com/vegidio/umd-lib/fetch"
+	"github.com/vegidio/umd-lib/umdtest"
+)
+
+var created = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+func TestReddit_Subreddit(t *testing.T) {
+	server := umdtest.Start(t)
+
+	// More than one page of the listing
+	for i := 0; i < 150; i++ {
+		server.Reddit().AddPost(umdtest.RedditPost{
+			Id:        fmt.Sprintf("post%d", i),
+			Subreddit: "pics",
+			Author:    "someone",
+			Created:   created,
+			Files:     []umdtest.File{{Name: fmt.Sprintf("image%d.jpg", i), Content: []byte("image")}},
+		})
+	}
+
+	server.Reddit().AddPost(umdtest.RedditPost{Id: "other", Subreddit: "other", Author: "someone",
+		Files: []umdtest.File{{Name: "other.jpg"}}})
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://www.reddit.com/r/pics/")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 150)
+	assert.Equal(t, "https://i.redd.it/image0.jpg", resp.Media[0].Url)
+	assert.Equal(t, "https://www.reddit.com/r/pics/comments/post0/", resp.Media[0].Metadata["page"])
+	assert.Equal(t, created, resp.Media[0].Metadata["created"].(time.Time).UTC())
+}
+
+func TestReddit_GalleryAndVideo(t *testing.T) {
+	server := umdtest.Start(t)
+
+	server.Reddit().AddPost(umdtest.RedditPost{Id: "gallery", Subreddit: "pics", Author: "someone", Files: []umdtest.File{
+		{Name: "first.jpg"}, {Name: "second.png"}, {Name: "third.gif"},
+	}})
+	urls := server.Reddit().AddPost(umdtest.RedditPost{Id: "video", Subreddit: "pics", Author: "someone",
+		Files: []umdtest.File{{Name: "DASH_720.mp4", Content: []byte("video content")}}})
+
+	u := umd.New(nil, server.Options()...)
+	extractor, _ := u.FindExtractor("https://www.reddit.com/r/pics/comments/gallery/title/")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 3)
+
+	extractor, _ = u.FindExtractor("https://www.reddit.com/user/someone/comments/video/title/")
+	resp, _ = extractor.QueryMedia(99999, nil, false)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, urls[0], resp.Media[0].Url)
+
+	// The media is served too
+	f := fetch.New(nil, 0, server.Options()...)
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	request, _ := f.NewRequest(resp.Media[0].Url, filePath)
+	assert.NoError(t, f.DownloadFile(request).Error())
+
+	data, _ := os.ReadFile(filePath)
+	assert.Equal(t, "video content", string(data))
+}
+
+func TestCoomer_User(t *testing.T) {
+	server := umdtest.Start(t)
+
+	for i := 0; i < 60; i++ {
+		server.Coomer().AddPost(umdtest.CoomerPost{
+			Id:          fmt.Sprintf("%d", i),
+			Service:     "onlyfans",
+			User:        "someone",
+			Published:   created,
+			Images:      []umdtest.File{{Name: "image.jpg", Content: []byte(fmt.Sprintf("image %d", i))}},
+			Attachments: []umdtest.File{{Name: "video.mp4", Content: []byte(fmt.Sprintf("video %d", i))}},
+		})
+	}
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://coomer.st/onlyfans/user/someone")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 120)
+	assert.True(t, strings.HasPrefix(resp.Media[0].Metadata["hash"].(string), "sha256:"))
+	assert.Equal(t, created, resp.Media[0].Metadata["created"])
+}
+
+func TestKemono_Post(t *testing.T) {
+	server := umdtest.Start(t)
+
+	urls := server.Kemono().AddPost(umdtest.CoomerPost{Id: "123", Service: "patreon", User: "someone",
+		Published: created, Images: []umdtest.File{{Name: "image.png", Content: []byte("image")}}})
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://kemono.cr/patreon/user/someone/post/123")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 1)
+	assert.Equal(t, urls[0], resp.Media[0].Url)
+}
+
+func TestRedGifs_User(t *testing.T) {
+	server := umdtest.Start(t)
+
+	for i := 0; i < 120; i++ {
+		server.RedGifs().AddGif(umdtest.RedGif{Id: fmt.Sprintf("gif%d", i), User: "someone", Created: created,
+			File: umdtest.File{Name: fmt.Sprintf("Gif%d.mp4", i)}})
+	}
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://www.redgifs.com/users/someone")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 120)
+	assert.Equal(t, "https://media.redgifs.com/Gif0.mp4", resp.Media[0].Url)
+}
+
+func TestRedGifs_Video(t *testing.T) {
+	server := umdtest.Start(t)
+	url := server.RedGifs().AddGif(umdtest.RedGif{Id: "sneakyfakeanimal", User: "someone", Created: created,
+		File: umdtest.File{Name: "SneakyFakeAnimal.mp4"}})
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://www.redgifs.com/watch/sneakyfakeanimal")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, url, resp.Media[0].Url)
+}
+
+func TestFapello_Model(t *testing.T) {
+	server := umdtest.Start(t)
+
+	for i := 1; i <= 40; i++ {
+		name := "image.jpg"
+		if i%10 == 0 {
+			name = "video.mp4"
+		}
+
+		server.Fapello().AddPost(umdtest.FapelloPost{Model: "someone", Id: i, File: umdtest.File{Name: name}})
+	}
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://fapello.com/someone/")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 40)
+
+	videos := 0
+	for _, media := range resp.Media {
+		if media.Extension == "mp4" {
+			videos++
+		}
+	}
+
+	assert.Equal(t, 4, videos)
+}
+
+func TestFapello_ModelBrokenPost(t *testing.T) {
+	server := umdtest.Start(t)
+	for i := 1; i <= 10; i++ {
+		server.Fapello().AddPost(umdtest.FapelloPost{Model: "someone", Id: i, File: umdtest.File{Name: "image.jpg"}})
+	}
+
+	server.FailRequests("fapello.com/someone/5/", http.StatusNotFound, 0)
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://fapello.com/someone/")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	// The broken post is skipped, and the other ones are still returned
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 9)
+}
+
+func TestImaglr_Post(t *testing.T) {
+	server := umdtest.Start(t)
+	url := server.Imaglr().AddPost(umdtest.ImaglrPost{Id: "5778297", Author: "someone", Created: created,
+		File: umdtest.File{Name: "video.mp4"}})
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://imaglr.com/post/5778297")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, url, resp.Media[0].Url)
+	assert.Equal(t, "someone", resp.Media[0].Metadata["name"])
+	assert.Equal(t, created, resp.Media[0].Metadata["created"].(time.Time).UTC())
+}
+
+func TestServer_FailRequests(t *testing.T) {
+	server := umdtest.Start(t)
+	server.Imaglr().AddPost(umdtest.ImaglrPost{Id: "1", Author: "someone", File: umdtest.File{Name: "image.jpg"}})
+	server.FailRequests("imaglr.com/post/", http.StatusNotFound, 1)
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://imaglr.com/post/1")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+	assert.Error(t, resp.Error())
+
+	// Only the first request fails
+	extractor, _ = umd.New(nil, server.Options()...).FindExtractor("https://imaglr.com/post/1")
+	resp, _ = extractor.QueryMedia(99999, nil, false)
+	assert.NoError(t, resp.Error())
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	server := umdtest.Start(t)
+	server.Reddit().AddPost(umdtest.RedditPost{Id: "abc", Subreddit: "pics", Author: "someone",
+		Files: []umdtest.File{{Name: "image.jpg"}}})
+	server.RateLimit("/comments/abc", 50*time.Millisecond, 2)
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://www.reddit.com/r/pics/comments/abc/title/")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+
+	// The extractor waits and retries the request
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Media, 1)
+
+	requests := 0
+	for _, request := range server.Requests() {
+		if strings.Contains(request, "/comments/abc") {
+			requests++
+		}
+	}
+
+	assert.Equal(t, 3, requests)
+}
+
+func TestCoomer_MirrorFailover(t *testing.T) {
+	server := umdtest.Start(t)
+	server.Coomer().AddPost(umdtest.CoomerPost{Id: "1", Service: "onlyfans", User: "someone", Published: created,
+		Attachments: []umdtest.File{{Name: "video.mp4", Content: []byte("video content")}}})
+
+	// The file server listed by the API is down
+	server.FailRequests("n1.coomer.st/data/", http.StatusServiceUnavailable, 0)
+
+	extractor, _ := umd.New(nil, server.Options()...).FindExtractor("https://coomer.st/onlyfans/user/someone/post/1")
+	resp, _ := extractor.QueryMedia(99999, nil, false)
+	assert.NoError(t, resp.Error())
+
+	f := fetch.New(nil, 0, server.Options()...)
+	dir := t.TempDir()
+	template, _ := fetch.ParsePathTemplate("{name}/{filename}.{ext}")
+	requests, _ := f.NewMediaRequests(resp.Media, dir, template)
+	assert.NoError(t, f.DownloadFile(requests[0]).Error())
+
+	data, _ := os.ReadFile(requests[0].FilePath)
+	assert.Equal(t, "video content", string(data))
+}